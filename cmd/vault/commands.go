@@ -0,0 +1,676 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"secure-file-vault/db"
+	"secure-file-vault/vault"
+)
+
+func runInit(e *env, args []string) error {
+	if err := e.parse(args, 0, 0); err != nil {
+		return err
+	}
+	if _, err := os.Stat(e.vaultPath); err == nil {
+		return fmt.Errorf("%s already exists", e.vaultPath)
+	}
+
+	password, err := e.password.readNew(e.stderr, "New password: ")
+	if err != nil {
+		return err
+	}
+	v, err := vault.CreateVault(e.vaultPath, password)
+	if err != nil {
+		return err
+	}
+	v.Close()
+
+	return e.print(map[string]string{"path": e.vaultPath}, func(w io.Writer) {
+		fmt.Fprintf(w, "created %s\n", e.vaultPath)
+	})
+}
+
+func runAdd(e *env, args []string) error {
+	dest := e.flags.String("dest", "", "vault `folder` to add to (default the root)")
+	if err := e.parse(args, 1, -1); err != nil {
+		return err
+	}
+
+	v, key, err := e.open(false)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	var added []string
+	for _, diskPath := range e.flags.Args() {
+		var names []string
+		names, err = addPath(v, key, diskPath, *dest)
+		added = append(added, names...)
+		if err != nil {
+			break
+		}
+	}
+
+	// Whatever was added before a failure is kept.
+	if len(added) > 0 {
+		if saveErr := v.Save(e.vaultPath); saveErr != nil {
+			return saveErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.print(map[string][]string{"added": added}, func(w io.Writer) {
+		for _, name := range added {
+			fmt.Fprintf(w, "added %s\n", name)
+		}
+	})
+}
+
+func addPath(v *vault.Vault, key []byte, diskPath, dest string) ([]string, error) {
+	file, err := os.Open(diskPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return v.AddDirectory(diskPath, key, vault.AddDirectoryOptions{Dest: dest})
+	}
+
+	name := path.Join(dest, filepath.Base(diskPath))
+	if err := v.AddFileWithMetadata(name, file, vault.NewMetadata(info), key); err != nil {
+		return nil, fmt.Errorf("failed to add %s: %v", diskPath, err)
+	}
+	return []string{name}, nil
+}
+
+// entryJSON is how ls prints an entry with -json.
+type entryJSON struct {
+	Name        string     `json:"name"`
+	Size        int64      `json:"size"`
+	Mode        string     `json:"mode,omitempty"`
+	ModTime     *time.Time `json:"mod_time,omitempty"`
+	Added       time.Time  `json:"added"`
+	Updated     time.Time  `json:"updated"`
+	ContentType string     `json:"content_type"`
+	Codec       string     `json:"codec,omitempty"`
+	Note        string     `json:"note,omitempty"`
+}
+
+// vaultName cleans a name given on the command line the way the vault
+// cleans the names it stores. The root is "".
+func vaultName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+}
+
+func runList(e *env, args []string) error {
+	if err := e.parse(args, 0, 1); err != nil {
+		return err
+	}
+	dir := vaultName(e.flags.Arg(0))
+
+	v, key, err := e.open(true)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	files, err := v.List(key)
+	if err != nil {
+		return err
+	}
+
+	entries := []entryJSON{}
+	for _, file := range files {
+		if dir != "" && !strings.HasPrefix(file.Name, dir+"/") {
+			continue
+		}
+		entry := entryJSON{
+			Name:        file.Name,
+			Size:        file.Size,
+			Added:       file.Added,
+			Updated:     file.Updated,
+			ContentType: file.ContentType,
+			Codec:       file.Codec,
+			Note:        file.Note,
+		}
+		if file.Mode != 0 {
+			entry.Mode = file.Mode.String()
+		}
+		if !file.ModTime.IsZero() {
+			modTime := file.ModTime
+			entry.ModTime = &modTime
+		}
+		entries = append(entries, entry)
+	}
+
+	return e.print(entries, func(w io.Writer) {
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%12d  %s  %s\n", entry.Size, entry.Updated.Local().Format("2006-01-02 15:04"), entry.Name)
+		}
+	})
+}
+
+// resultJSON is how extract and import print what they did with an entry.
+type resultJSON struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+var conflictPolicies = map[string]vault.ConflictPolicy{
+	"overwrite": vault.ConflictOverwrite,
+	"skip":      vault.ConflictSkip,
+	"rename":    vault.ConflictRename,
+}
+
+func runExtract(e *env, args []string) error {
+	outputDir := e.flags.String("o", ".", "`directory` to extract into")
+	conflict := e.flags.String("conflict", "skip", "what to do with existing files: overwrite, skip or rename")
+	toStdout := e.flags.Bool("stdout", false, "write the one named entry to standard output")
+	if err := e.parse(args, 0, -1); err != nil {
+		return err
+	}
+	policy, ok := conflictPolicies[*conflict]
+	if !ok || (*toStdout && e.flags.NArg() != 1) {
+		e.flags.Usage()
+		return errUsage
+	}
+
+	v, key, err := e.open(true)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	if *toStdout {
+		return v.ExtractFileTo(vaultName(e.flags.Arg(0)), key, e.stdout)
+	}
+
+	results, err := extractNames(v, key, e.flags.Args(), *outputDir, policy)
+	if err != nil {
+		return err
+	}
+
+	out := make([]resultJSON, 0, len(results))
+	failed := 0
+	for _, result := range results {
+		r := resultJSON{Name: result.Name, Path: result.Path, Action: result.Action}
+		if result.Err != nil {
+			r.Error = result.Err.Error()
+			failed++
+		}
+		out = append(out, r)
+	}
+
+	err = e.print(out, func(w io.Writer) {
+		for _, r := range out {
+			if r.Error != "" {
+				fmt.Fprintf(w, "%s: %s (%s)\n", r.Name, r.Action, r.Error)
+			} else {
+				fmt.Fprintf(w, "%s: %s %s\n", r.Name, r.Action, r.Path)
+			}
+		}
+	})
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("%d of %d entries failed", failed, len(results))
+	}
+	return err
+}
+
+// extractNames extracts the whole vault if names is empty, and otherwise
+// each named folder with its structure and each named file on its own.
+func extractNames(v *vault.Vault, key []byte, names []string, outputDir string, policy vault.ConflictPolicy) ([]vault.ExtractResult, error) {
+	if len(names) == 0 {
+		return v.ExtractAll(outputDir, key, policy)
+	}
+
+	dirs, err := v.ListDirs(key)
+	if err != nil {
+		return nil, err
+	}
+	isDir := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		isDir[dir] = true
+	}
+
+	var results, fileResults []vault.ExtractResult
+	var fileNames []string
+	for _, name := range names {
+		name = vaultName(name)
+		if !isDir[name] {
+			fileNames = append(fileNames, name)
+			continue
+		}
+		treeResults, err := v.ExtractTree(name, outputDir, key, policy)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, treeResults...)
+	}
+	if len(fileNames) > 0 {
+		if fileResults, err = v.ExtractFiles(fileNames, outputDir, key, policy); err != nil {
+			return nil, err
+		}
+	}
+	return append(results, fileResults...), nil
+}
+
+func runRemove(e *env, args []string) error {
+	if err := e.parse(args, 1, -1); err != nil {
+		return err
+	}
+
+	v, key, err := e.open(false)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	dirs, err := v.ListDirs(key)
+	if err != nil {
+		return err
+	}
+	isDir := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		isDir[dir] = true
+	}
+
+	var removed []string
+	for _, name := range e.flags.Args() {
+		name = vaultName(name)
+		if isDir[name] {
+			err = v.RemoveDir(name, key)
+		} else {
+			err = v.RemoveFile(name, key)
+		}
+		if err != nil {
+			break
+		}
+		removed = append(removed, name)
+	}
+
+	if len(removed) > 0 {
+		if saveErr := v.Save(e.vaultPath); saveErr != nil {
+			return saveErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.print(map[string][]string{"trashed": removed}, func(w io.Writer) {
+		for _, name := range removed {
+			fmt.Fprintf(w, "moved %s to the trash\n", name)
+		}
+	})
+}
+
+func runUpdate(e *env, args []string) error {
+	if err := e.parse(args, 1, 2); err != nil {
+		return err
+	}
+	name := vaultName(e.flags.Arg(0))
+
+	var r io.Reader = os.Stdin
+	if source := e.flags.Arg(1); source != "" && source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	v, key, err := e.open(false)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	if err := v.UpdateFileFrom(name, key, r); err != nil {
+		return err
+	}
+	if err := v.Save(e.vaultPath); err != nil {
+		return err
+	}
+
+	return e.print(map[string]string{"updated": name}, func(w io.Writer) {
+		fmt.Fprintf(w, "updated %s\n", name)
+	})
+}
+
+func runPasswd(e *env, args []string) error {
+	var newPassword passwordFlags
+	newPassword.register(e.flags, "new-password", "VAULT_NEW_PASSWORD")
+	dbPath := e.flags.String("db", "", "GUI user `database`; the login of the user whose vault this is changes too")
+	force := e.flags.Bool("force", false, "change the vault password even if no GUI login is known to use it")
+	if err := e.parse(args, 0, 0); err != nil {
+		return err
+	}
+	if *dbPath == "" && !*force {
+		return errors.New("a GUI login may use this vault; name its database with -db, or use -force to change only the vault password")
+	}
+
+	var dbConn *sql.DB
+	var username string
+	if *dbPath != "" {
+		// Opening a database that does not exist would create it.
+		if _, err := os.Stat(*dbPath); err != nil {
+			return err
+		}
+		var err error
+		if dbConn, err = db.InitDB(*dbPath); err != nil {
+			return err
+		}
+		defer dbConn.Close()
+
+		usernames, err := vaultUsers(dbConn, *dbPath, e.vaultPath)
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(usernames) > 1:
+			return fmt.Errorf("several users log in to %s: %s", e.vaultPath, strings.Join(usernames, ", "))
+		case len(usernames) == 1:
+			username = usernames[0]
+		case !*force:
+			return fmt.Errorf("no user in %s logs in to %s; use -force to change only the vault password", *dbPath, e.vaultPath)
+		}
+	}
+
+	oldPassword, err := e.password.read(e.stderr, "Current password: ")
+	if err != nil {
+		return err
+	}
+	v, _, err := vault.OpenVault(e.vaultPath, oldPassword)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	password, err := newPassword.readNew(e.stderr, "New password: ")
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		return errors.New("the new password is empty")
+	}
+
+	if username == "" {
+		err = v.ChangePassword(e.vaultPath, oldPassword, password)
+	} else {
+		err = db.ChangePassword(dbConn, username, oldPassword, password, func() (func() error, error) {
+			change, err := v.PreparePasswordChange(oldPassword, password)
+			if err != nil {
+				return nil, err
+			}
+			return func() error {
+				return change.Save(e.vaultPath)
+			}, nil
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	result := map[string]string{"path": e.vaultPath}
+	if username != "" {
+		result["user"] = username
+	}
+	return e.print(result, func(w io.Writer) {
+		if username != "" {
+			fmt.Fprintf(w, "password changed for %s\n", username)
+			return
+		}
+		fmt.Fprintln(w, "password changed")
+	})
+}
+
+// vaultUsers returns the users in the GUI database at dbPath that log in
+// to the vault at vaultPath. The GUI stores relative vault paths relative
+// to the folder it runs in, which is where its database is.
+func vaultUsers(dbConn *sql.DB, dbPath, vaultPath string) ([]string, error) {
+	info, err := os.Stat(vaultPath)
+	if err != nil {
+		return nil, err
+	}
+	vaultPaths, err := db.VaultPaths(dbConn)
+	if err != nil {
+		return nil, err
+	}
+
+	var usernames []string
+	for username, userVault := range vaultPaths {
+		if !filepath.IsAbs(userVault) {
+			userVault = filepath.Join(filepath.Dir(dbPath), userVault)
+		}
+		if userInfo, err := os.Stat(userVault); err == nil && os.SameFile(info, userInfo) {
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
+
+// verifyJSON is what verify prints with -json.
+type verifyJSON struct {
+	Files    int           `json:"files"`
+	Trashed  int           `json:"trashed"`
+	Bodies   int           `json:"bodies"`
+	Problems []problemJSON `json:"problems"`
+	Repaired bool          `json:"repaired"`
+}
+
+type problemJSON struct {
+	Kind    string `json:"kind"`
+	Index   uint64 `json:"index"`
+	Name    string `json:"name,omitempty"`
+	Version int    `json:"version,omitempty"`
+	Blob    string `json:"blob,omitempty"`
+	InTrash bool   `json:"in_trash,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+func runVerify(e *env, args []string) error {
+	repair := e.flags.Bool("repair", false, "quarantine bad entries and delete orphaned blobs")
+	if err := e.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	v, key, err := e.open(!*repair)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	var report vault.VerifyReport
+	if *repair {
+		report, err = v.Repair(key)
+		if err == nil && report.Repaired {
+			err = v.Save(e.vaultPath)
+		}
+	} else {
+		report, err = v.Verify(key)
+	}
+	if err != nil {
+		return err
+	}
+
+	out := verifyJSON{
+		Files:    report.Files,
+		Trashed:  report.Trashed,
+		Bodies:   report.Bodies,
+		Problems: []problemJSON{},
+		Repaired: report.Repaired,
+	}
+	for _, problem := range report.Problems {
+		out.Problems = append(out.Problems, problemJSON{
+			Kind:    problem.Kind,
+			Index:   problem.Index,
+			Name:    problem.Name,
+			Version: problem.Version + 1,
+			Blob:    problem.Blob,
+			InTrash: problem.InTrash,
+			Detail:  problem.Detail,
+		})
+	}
+
+	err = e.print(out, func(w io.Writer) {
+		for _, problem := range report.Problems {
+			fmt.Fprintln(w, problem)
+		}
+		fmt.Fprintf(w, "checked %d files, %d in trash, %d bodies: %d problems\n", report.Files, report.Trashed, report.Bodies, len(report.Problems))
+		if report.Repaired {
+			fmt.Fprintln(w, "bad entries were quarantined")
+		}
+	})
+
+	// Corruption is a failure even once repaired, so scripts notice it.
+	if err == nil && !report.OK() {
+		err = fmt.Errorf("found %d problems", len(report.Problems))
+	}
+	return err
+}
+
+func runExport(e *env, args []string) error {
+	output := e.flags.String("o", "", "bundle `file` to write, or - for standard output")
+	var passphrase passwordFlags
+	passphrase.register(e.flags, "passphrase", "VAULT_BUNDLE_PASSPHRASE")
+	if err := e.parse(args, 0, -1); err != nil {
+		return err
+	}
+	if *output == "" {
+		e.flags.Usage()
+		return errUsage
+	}
+
+	v, key, err := e.open(true)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	bundlePassphrase, err := passphrase.readNew(e.stderr, "Bundle passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	w := e.stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	exported, err := v.ExportBundle(e.flags.Args(), bundlePassphrase, key, w)
+	if err != nil {
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		return err
+	}
+
+	// With the bundle on standard output, the report goes to stderr.
+	if *output == "-" {
+		e.stdout = e.stderr
+	}
+	return e.print(map[string][]string{"exported": exported}, func(w io.Writer) {
+		for _, name := range exported {
+			fmt.Fprintf(w, "exported %s\n", name)
+		}
+	})
+}
+
+func runImport(e *env, args []string) error {
+	dest := e.flags.String("dest", "", "vault `folder` to import into (default the root)")
+	conflict := e.flags.String("conflict", "skip", "what to do with existing entries: overwrite, skip or rename")
+	var passphrase passwordFlags
+	passphrase.register(e.flags, "passphrase", "VAULT_BUNDLE_PASSPHRASE")
+	if err := e.parse(args, 1, 1); err != nil {
+		return err
+	}
+	policy, ok := conflictPolicies[*conflict]
+	if !ok {
+		e.flags.Usage()
+		return errUsage
+	}
+
+	var r io.Reader = os.Stdin
+	if source := e.flags.Arg(0); source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	v, key, err := e.open(false)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	bundlePassphrase, err := passphrase.read(e.stderr, "Bundle passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	results, err := v.ImportBundle(r, bundlePassphrase, key, vault.ImportOptions{Dest: *dest, Policy: policy})
+
+	// Whatever was imported before a failure is kept.
+	if len(results) > 0 {
+		if saveErr := v.Save(e.vaultPath); saveErr != nil {
+			return saveErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	out := make([]resultJSON, 0, len(results))
+	failed := 0
+	for _, result := range results {
+		r := resultJSON{Name: result.Name, Path: result.Path, Action: result.Action}
+		if result.Err != nil {
+			r.Error = result.Err.Error()
+			failed++
+		}
+		out = append(out, r)
+	}
+
+	err = e.print(out, func(w io.Writer) {
+		for _, r := range out {
+			if r.Error != "" {
+				fmt.Fprintf(w, "%s: %s (%s)\n", r.Name, r.Action, r.Error)
+			} else {
+				fmt.Fprintf(w, "%s: %s %s\n", r.Name, r.Action, r.Path)
+			}
+		}
+	})
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("%d of %d entries failed", failed, len(results))
+	}
+	return err
+}
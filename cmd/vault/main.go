@@ -0,0 +1,177 @@
+// Command vault works with a vault from the command line, for scripts,
+// servers and CI where the GUI cannot run.
+//
+// Usage:
+//
+//	vault <command> [flags] [arguments]
+//
+// Every command takes -f to name the vault file (default $VAULT_PATH),
+// -json to print machine-readable output, and the password flags described
+// in passwordFlags. Run "vault help" for the list of commands.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"secure-file-vault/vault"
+)
+
+// Exit statuses. A command that ran but found a problem, such as a file
+// that failed its integrity check, exits with exitFailure.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// errUsage is returned by commands called with the wrong arguments. The
+// command's usage has already been printed.
+var errUsage = errors.New("usage")
+
+type command struct {
+	usage string
+	help  string
+	run   func(env *env, args []string) error
+}
+
+var commands = map[string]command{
+	"init":    {"init", "create a new vault", runInit},
+	"add":     {"add [-dest folder] path...", "add files and directories", runAdd},
+	"ls":      {"ls [folder]", "list entries", runList},
+	"extract": {"extract [-o dir] [-conflict overwrite|skip|rename] [-stdout] [name...]", "extract entries, folders or the whole vault", runExtract},
+	"rm":      {"rm name...", "move entries or folders to the trash", runRemove},
+	"update":  {"update name [file]", "replace an entry's content from a file or stdin", runUpdate},
+	"passwd":  {"passwd [-db file] [-force]", "change the vault password", runPasswd},
+	"verify":  {"verify [-repair]", "check the whole vault's integrity", runVerify},
+	"export":  {"export -o file [name...]", "export entries or folders as a bundle with its own passphrase", runExport},
+	"import":  {"import [-dest folder] [-conflict overwrite|skip|rename] file", "import a bundle", runImport},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "vault: unknown command %q\n", args[0])
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	e := &env{stdout: stdout, stderr: stderr}
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: vault %s\n\n", cmd.usage)
+		flags.PrintDefaults()
+	}
+	e.flags = flags
+	e.register()
+
+	err := cmd.run(e, args[1:])
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	}
+	fmt.Fprintf(stderr, "vault %s: %v\n", args[0], err)
+	return exitFailure
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: vault <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-8s %s\n", name, commands[name].help)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "vault <command> -h" for a command's flags.`)
+}
+
+// env holds what every command shares: its flags, where output goes and
+// how the vault is found and unlocked.
+type env struct {
+	flags  *flag.FlagSet
+	stdout io.Writer
+	stderr io.Writer
+
+	vaultPath string
+	json      bool
+	password  passwordFlags
+}
+
+func (e *env) register() {
+	e.flags.StringVar(&e.vaultPath, "f", os.Getenv("VAULT_PATH"), "vault `file` (default $VAULT_PATH)")
+	e.flags.BoolVar(&e.json, "json", false, "print machine-readable JSON")
+	e.password.register(e.flags, "password", "VAULT_PASSWORD")
+}
+
+// parse parses the command's flags and checks that a vault was named and
+// that the number of arguments is within [min, max]; max < 0 means no
+// limit.
+func (e *env) parse(args []string, min, max int) error {
+	if err := e.flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	n := e.flags.NArg()
+	if e.vaultPath == "" || n < min || (max >= 0 && n > max) {
+		if e.vaultPath == "" {
+			fmt.Fprintln(e.stderr, "vault: no vault file; use -f or set VAULT_PATH")
+		}
+		e.flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// open unlocks the vault, read-only if the command does not change it.
+func (e *env) open(readOnly bool) (*vault.Vault, []byte, error) {
+	password, err := e.password.read(e.stderr, "Password: ")
+	if err != nil {
+		return nil, nil, err
+	}
+	if readOnly {
+		return vault.OpenVaultReadOnly(e.vaultPath, password)
+	}
+	return vault.OpenVault(e.vaultPath, password)
+}
+
+// print writes v as JSON with -json, or else calls text to write it for
+// people.
+func (e *env) print(v any, text func(w io.Writer)) error {
+	if !e.json {
+		text(e.stdout)
+		return nil
+	}
+	encoder := json.NewEncoder(e.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
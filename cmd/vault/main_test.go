@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"secure-file-vault/db"
+)
+
+const testPassword = "correct horse battery staple"
+
+// vaultRun runs the vault command with args and returns what it printed
+// and its exit status.
+func vaultRun(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+// mustRun runs the vault command and fails the test unless it succeeds.
+func mustRun(t *testing.T, args ...string) string {
+	t.Helper()
+	stdout, stderr, code := vaultRun(t, args...)
+	if code != exitOK {
+		t.Fatalf("vault %s exited with %d: %s", strings.Join(args, " "), code, stderr)
+	}
+	return stdout
+}
+
+// newCLIVault points $VAULT_PATH at a new vault, unlocked through
+// $VAULT_PASSWORD, and returns its path.
+func newCLIVault(t *testing.T) string {
+	t.Helper()
+	vaultPath := filepath.Join(t.TempDir(), "vault.dat")
+	t.Setenv("VAULT_PATH", vaultPath)
+	t.Setenv("VAULT_PASSWORD", testPassword)
+	t.Setenv("VAULT_NEW_PASSWORD", "")
+	if out := mustRun(t, "init"); !strings.Contains(out, vaultPath) {
+		t.Errorf("init printed %q", out)
+	}
+	return vaultPath
+}
+
+// writeFiles creates files under dir, keyed by slash-separated path.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		diskPath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(diskPath), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(diskPath, []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listNames returns the names ls -json prints for args.
+func listNames(t *testing.T, args ...string) []string {
+	t.Helper()
+	var entries []entryJSON
+	if err := json.Unmarshal([]byte(mustRun(t, append([]string{"ls", "-json"}, args...)...)), &entries); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	return names
+}
+
+func TestUsage(t *testing.T) {
+	t.Setenv("VAULT_PATH", "")
+	for _, test := range []struct {
+		args []string
+		code int
+	}{
+		{nil, exitUsage},
+		{[]string{"help"}, exitOK},
+		{[]string{"frobnicate"}, exitUsage},
+		{[]string{"ls"}, exitUsage}, // no vault file
+		{[]string{"ls", "-h"}, exitOK},
+		{[]string{"ls", "-f", "vault.dat", "a", "b"}, exitUsage},
+		{[]string{"ls", "-f", "vault.dat", "-bogus"}, exitUsage},
+		{[]string{"extract", "-f", "vault.dat", "-conflict", "bogus"}, exitUsage},
+		{[]string{"extract", "-f", "vault.dat", "-stdout", "a", "b"}, exitUsage},
+		{[]string{"update", "-f", "vault.dat"}, exitUsage},
+		{[]string{"export", "-f", "vault.dat"}, exitUsage},
+	} {
+		if _, stderr, code := vaultRun(t, test.args...); code != test.code {
+			t.Errorf("vault %s exited with %d, want %d: %s", strings.Join(test.args, " "), code, test.code, stderr)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	newCLIVault(t)
+	if _, _, code := vaultRun(t, "init"); code != exitFailure {
+		t.Errorf("init over an existing vault exited with %d", code)
+	}
+
+	disk := t.TempDir()
+	writeFiles(t, disk, map[string]string{
+		"notes.txt":      "notes",
+		"docs/a.txt":     "a",
+		"docs/sub/b.txt": "b",
+	})
+	mustRun(t, "add", "-dest", "inbox", filepath.Join(disk, "notes.txt"))
+	var added map[string][]string
+	if err := json.Unmarshal([]byte(mustRun(t, "add", "-json", filepath.Join(disk, "docs"))), &added); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"docs/a.txt", "docs/sub/b.txt", "inbox/notes.txt"}
+	got := added["added"]
+	slices.Sort(got)
+	if !slices.Equal(got, want[:2]) {
+		t.Errorf("added %v, want %v", got, want[:2])
+	}
+	if names := listNames(t); !slices.Equal(names, want) {
+		t.Errorf("ls: %v, want %v", names, want)
+	}
+	if names := listNames(t, "docs"); !slices.Equal(names, want[:2]) {
+		t.Errorf("ls docs: %v", names)
+	}
+	if out := mustRun(t, "ls"); !strings.Contains(out, "inbox/notes.txt") {
+		t.Errorf("ls printed %q", out)
+	}
+
+	// Names given on the command line are cleaned like stored ones.
+	if out := mustRun(t, "extract", "-stdout", "./inbox//notes.txt"); out != "notes" {
+		t.Errorf("extract -stdout printed %q", out)
+	}
+	if _, _, code := vaultRun(t, "extract", "-stdout", "missing.txt"); code != exitFailure {
+		t.Errorf("extracting a missing entry exited with %d", code)
+	}
+
+	outDir := t.TempDir()
+	var results []resultJSON
+	if err := json.Unmarshal([]byte(mustRun(t, "extract", "-json", "-o", outDir, "docs")), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Action != "created" {
+		t.Errorf("extract docs: %+v", results)
+	}
+	if data, err := os.ReadFile(filepath.Join(outDir, "docs", "sub", "b.txt")); err != nil || string(data) != "b" {
+		t.Errorf("extracted docs/sub/b.txt holds %q, %v", data, err)
+	}
+	results = nil
+	if err := json.Unmarshal([]byte(mustRun(t, "extract", "-json", "-o", outDir, "-conflict", "skip", "docs")), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Action != "skipped" || results[1].Action != "skipped" {
+		t.Errorf("extracting over existing files: %+v", results)
+	}
+	// A file named on its own is extracted without its folders.
+	mustRun(t, "extract", "-o", outDir, "docs/a.txt")
+	if data, err := os.ReadFile(filepath.Join(outDir, "a.txt")); err != nil || string(data) != "a" {
+		t.Errorf("extracted a.txt holds %q, %v", data, err)
+	}
+
+	writeFiles(t, disk, map[string]string{"new.txt": "new notes"})
+	mustRun(t, "update", "/inbox/notes.txt", filepath.Join(disk, "new.txt"))
+	if out := mustRun(t, "extract", "-stdout", "inbox/notes.txt"); out != "new notes" {
+		t.Errorf("after update, extract -stdout printed %q", out)
+	}
+	if _, _, code := vaultRun(t, "update", "missing.txt", filepath.Join(disk, "new.txt")); code != exitFailure {
+		t.Errorf("updating a missing entry exited with %d", code)
+	}
+
+	mustRun(t, "rm", "docs/sub", "inbox/notes.txt")
+	if names := listNames(t); !slices.Equal(names, []string{"docs/a.txt"}) {
+		t.Errorf("ls after rm: %v", names)
+	}
+	if _, _, code := vaultRun(t, "rm", "missing.txt"); code != exitFailure {
+		t.Errorf("removing a missing entry exited with %d", code)
+	}
+
+	var report verifyJSON
+	if err := json.Unmarshal([]byte(mustRun(t, "verify", "-json")), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 1 || report.Trashed != 2 || len(report.Problems) != 0 {
+		t.Errorf("verify: %+v", report)
+	}
+}
+
+func TestWrongPassword(t *testing.T) {
+	newCLIVault(t)
+	t.Setenv("VAULT_PASSWORD", "wrong password")
+	for _, args := range [][]string{{"ls"}, {"extract", "-stdout", "a.txt"}, {"verify"}, {"rm", "a.txt"}} {
+		stdout, stderr, code := vaultRun(t, args...)
+		if code != exitFailure || stdout != "" || !strings.Contains(stderr, "invalid password") {
+			t.Errorf("vault %s with the wrong password exited with %d: %q, %q", args[0], code, stdout, stderr)
+		}
+	}
+
+	// -password-env takes precedence over $VAULT_PASSWORD.
+	t.Setenv("RIGHT_PASSWORD", testPassword)
+	mustRun(t, "ls", "-password-env", "RIGHT_PASSWORD")
+	if _, _, code := vaultRun(t, "ls", "-password-env", "UNSET_PASSWORD"); code != exitFailure {
+		t.Errorf("ls with an unset -password-env exited with %d", code)
+	}
+}
+
+func TestPasswd(t *testing.T) {
+	newCLIVault(t)
+	t.Setenv("VAULT_NEW_PASSWORD", "new password")
+
+	// A GUI login may share the password, so it is only changed alone
+	// with -force.
+	if _, stderr, code := vaultRun(t, "passwd"); code != exitFailure || !strings.Contains(stderr, "-force") {
+		t.Errorf("passwd without -db or -force exited with %d: %s", code, stderr)
+	}
+	mustRun(t, "passwd", "-force")
+
+	if _, _, code := vaultRun(t, "ls"); code != exitFailure {
+		t.Errorf("ls with the old password exited with %d", code)
+	}
+	t.Setenv("VAULT_PASSWORD", "new password")
+	mustRun(t, "ls")
+}
+
+func TestPasswdDB(t *testing.T) {
+	vaultPath := newCLIVault(t)
+	dbPath := filepath.Join(t.TempDir(), "users.db")
+	dbConn, err := db.InitDB(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbConn.Close()
+	if err := db.CreateUsersTable(dbConn); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RegisterUser(dbConn, "alice", testPassword, vaultPath); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("VAULT_NEW_PASSWORD", "new password")
+	var result map[string]string
+	if err := json.Unmarshal([]byte(mustRun(t, "passwd", "-json", "-db", dbPath)), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result["user"] != "alice" || result["path"] != vaultPath {
+		t.Errorf("passwd printed %v", result)
+	}
+	if _, err := db.AuthenticateUser(dbConn, "alice", "new password"); err != nil {
+		t.Errorf("login with the new password: %v", err)
+	}
+	t.Setenv("VAULT_PASSWORD", "new password")
+	mustRun(t, "ls")
+
+	if _, _, code := vaultRun(t, "passwd", "-db", filepath.Join(t.TempDir(), "missing.db")); code != exitFailure {
+		t.Errorf("passwd with a missing database exited with %d", code)
+	}
+}
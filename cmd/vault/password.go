@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// passwordFlags says where a password comes from. In order of preference:
+// a file descriptor given with -<name>-fd, an environment variable named
+// with -<name>-env, the variable envDefault, or a prompt on the terminal.
+type passwordFlags struct {
+	name       string
+	envDefault string
+	fd         int
+	envName    string
+}
+
+// fdReaders holds one reader per file descriptor, so that passwords given
+// on the same descriptor are read line after line.
+var fdReaders = make(map[int]*bufio.Reader)
+
+func (p *passwordFlags) register(flags *flag.FlagSet, name, envDefault string) {
+	p.name = name
+	p.envDefault = envDefault
+	flags.IntVar(&p.fd, name+"-fd", -1, "read the "+name+" from the first line of file descriptor `n`")
+	flags.StringVar(&p.envName, name+"-env", "", "read the "+name+" from environment variable `var` (default $"+envDefault+")")
+}
+
+// read returns the password, prompting for it with prompt if no other
+// source was given.
+func (p *passwordFlags) read(stderr io.Writer, prompt string) (string, error) {
+	if p.fd >= 0 {
+		reader, ok := fdReaders[p.fd]
+		if !ok {
+			file := os.NewFile(uintptr(p.fd), p.name)
+			if file == nil {
+				return "", fmt.Errorf("invalid file descriptor %d", p.fd)
+			}
+			reader = bufio.NewReader(file)
+			fdReaders[p.fd] = reader
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			return "", fmt.Errorf("failed to read %s from file descriptor %d: %v", p.name, p.fd, err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	if p.envName != "" {
+		password, ok := os.LookupEnv(p.envName)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", p.envName)
+		}
+		return password, nil
+	}
+	if password := os.Getenv(p.envDefault); password != "" {
+		return password, nil
+	}
+
+	return promptPassword(stderr, prompt)
+}
+
+// readNew returns a new password, asking for it twice if it is typed in.
+func (p *passwordFlags) readNew(stderr io.Writer, prompt string) (string, error) {
+	if p.fd >= 0 || p.envName != "" || os.Getenv(p.envDefault) != "" {
+		return p.read(stderr, prompt)
+	}
+
+	password, err := promptPassword(stderr, prompt)
+	if err != nil {
+		return "", err
+	}
+	again, err := promptPassword(stderr, "Repeat "+strings.ToLower(prompt))
+	if err != nil {
+		return "", err
+	}
+	if password != again {
+		return "", errors.New("passwords do not match")
+	}
+	return password, nil
+}
+
+func promptPassword(stderr io.Writer, prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("no password given; use a terminal, -password-fd or $VAULT_PASSWORD")
+	}
+
+	fmt.Fprint(stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %v", err)
+	}
+	return string(password), nil
+}
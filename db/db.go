@@ -3,6 +3,8 @@ package db
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
@@ -38,6 +40,33 @@ func CreateUsersTable(db *sql.DB) error {
 	return err
 }
 
+// CreatePublicKeysTable creates the table of each user's public key, which
+// other users share entries to.
+func CreatePublicKeysTable(db *sql.DB) error {
+	createTableSQL := `CREATE TABLE IF NOT EXISTS public_keys (
+    "username" TEXT NOT NULL PRIMARY KEY,
+    "public_key" BLOB NOT NULL
+    );`
+	_, err := db.Exec(createTableSQL)
+	return err
+}
+
+// CreateSharesTable creates the table of entries shared between users
+// that the recipient has not yet accepted or declined. The payload is
+// encrypted to the recipient's public key.
+func CreateSharesTable(db *sql.DB) error {
+	createTableSQL := `CREATE TABLE IF NOT EXISTS shares (
+    "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    "sender" TEXT NOT NULL,
+    "recipient" TEXT NOT NULL,
+    "name" TEXT NOT NULL,
+    "created" TIMESTAMP NOT NULL,
+    "payload" BLOB NOT NULL
+    );`
+	_, err := db.Exec(createTableSQL)
+	return err
+}
+
 func RegisterUser(db *sql.DB, username, password, vaultPath string) error {
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -63,6 +92,193 @@ func AuthenticateUser(db *sql.DB, username, password string) (string, error) {
 	return vaultPath, nil
 }
 
+// VaultPaths returns the vault path of every user, by username.
+func VaultPaths(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT username, vault_path FROM users")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vaultPaths := make(map[string]string)
+	for rows.Next() {
+		var username, vaultPath string
+		if err := rows.Scan(&username, &vaultPath); err != nil {
+			return nil, err
+		}
+		vaultPaths[username] = vaultPath
+	}
+	return vaultPaths, rows.Err()
+}
+
+// ChangePassword replaces the password hash of username and, through
+// prepareVault, the password of the user's vault. prepareVault checks and
+// derives the new vault password without saving it, and returns a function
+// that saves it. The slow hashing happens before anything is written.
+//
+// The new hash is committed first and the vault saved afterwards. If the
+// commit fails the vault is not touched, and if the vault cannot be saved
+// the old hash is put back, so the user keeps logging in with the old
+// password. Only if putting it back fails too do the two disagree, and the
+// error says so.
+//
+// Compensating is enough because this order keeps the vault safe when the
+// process dies between the two writes: the login then takes the new
+// password and the vault still opens with the old one, which vault passwd
+// -force can move onto the new one. The other order would leave a login
+// only the old password passes and a vault only the new one opens, and no
+// tool could bring them together without editing the database.
+func ChangePassword(db *sql.DB, username, oldPassword, newPassword string, prepareVault func() (func() error, error)) error {
+	var passwordHash string
+	err := db.QueryRow("SELECT password_hash FROM users WHERE username = ?", username).Scan(&passwordHash)
+	if err != nil {
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(oldPassword))
+	if err != nil {
+		return errors.New("invalid password")
+	}
+
+	newPasswordHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	saveVault, err := prepareVault()
+	if err != nil {
+		return err
+	}
+
+	if err := setPasswordHash(db, username, []byte(passwordHash), newPasswordHash); err != nil {
+		return err
+	}
+
+	if err := saveVault(); err != nil {
+		if restoreErr := setPasswordHash(db, username, newPasswordHash, []byte(passwordHash)); restoreErr != nil {
+			return fmt.Errorf("%v; the login password was changed but the vault password was not, and restoring the login password failed: %v", err, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// setPasswordHash replaces the password hash of username with newHash in
+// a transaction, provided it is still oldHash.
+func setPasswordHash(db *sql.DB, username string, oldHash, newHash []byte) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE users SET password_hash = ? WHERE username = ? AND CAST(password_hash AS BLOB) = ?", newHash, username, oldHash)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("the password was changed meanwhile")
+	}
+	return tx.Commit()
+}
+
+// SetPublicKey records the public key of username.
+func SetPublicKey(db *sql.DB, username string, publicKey []byte) error {
+	_, err := db.Exec("INSERT OR REPLACE INTO public_keys (username, public_key) VALUES (?, ?)", username, publicKey)
+	return err
+}
+
+func GetPublicKey(db *sql.DB, username string) ([]byte, error) {
+	var publicKey []byte
+	err := db.QueryRow("SELECT public_key FROM public_keys WHERE username = ?", username).Scan(&publicKey)
+	return publicKey, err
+}
+
+// ListRecipients returns the users, other than username, that entries can
+// be shared with.
+func ListRecipients(db *sql.DB, username string) ([]string, error) {
+	rows, err := db.Query("SELECT username FROM public_keys WHERE username != ? ORDER BY username", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []string
+	for rows.Next() {
+		var recipient string
+		if err := rows.Scan(&recipient); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, rows.Err()
+}
+
+// Share is a pending share, without its payload.
+type Share struct {
+	ID        int64
+	Sender    string
+	Recipient string
+	Name      string
+	Created   time.Time
+}
+
+func AddShare(db *sql.DB, sender, recipient, name string, payload []byte) error {
+	_, err := db.Exec("INSERT INTO shares (sender, recipient, name, created, payload) VALUES (?, ?, ?, ?, ?)",
+		sender, recipient, name, time.Now().UTC(), payload)
+	return err
+}
+
+// ListSharesTo returns the shares waiting for username, oldest first.
+func ListSharesTo(db *sql.DB, username string) ([]Share, error) {
+	return listShares(db, "SELECT id, sender, recipient, name, created FROM shares WHERE recipient = ? ORDER BY id", username)
+}
+
+// ListSharesFrom returns the shares username sent that are still pending.
+func ListSharesFrom(db *sql.DB, username string) ([]Share, error) {
+	return listShares(db, "SELECT id, sender, recipient, name, created FROM shares WHERE sender = ? ORDER BY id", username)
+}
+
+func listShares(db *sql.DB, query, username string) ([]Share, error) {
+	rows, err := db.Query(query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []Share
+	for rows.Next() {
+		var share Share
+		if err := rows.Scan(&share.ID, &share.Sender, &share.Recipient, &share.Name, &share.Created); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+// GetSharePayload returns the payload of a share sent to recipient.
+func GetSharePayload(db *sql.DB, id int64, recipient string) ([]byte, error) {
+	var payload []byte
+	err := db.QueryRow("SELECT payload FROM shares WHERE id = ? AND recipient = ?", id, recipient).Scan(&payload)
+	return payload, err
+}
+
+// DeleteShare removes a share that username sent, revoking it, or that
+// was sent to username, once it has been accepted or declined.
+func DeleteShare(db *sql.DB, id int64, username string) error {
+	result, err := db.Exec("DELETE FROM shares WHERE id = ? AND (sender = ? OR recipient = ?)", id, username, username)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func AddVault(db *sql.DB, vaultPath, salt, keyHash string) error {
 	insertSQL := `INSERT INTO vaults (path, salt, key_hash) VALUES (?, ?, ?);`
 	_, err := db.Exec(insertSQL, vaultPath, salt, keyHash)
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"secure-file-vault/vault"
+	"testing"
+)
+
+func newTestDB(t *testing.T, dsn string) *sql.DB {
+	t.Helper()
+	db, err := InitDB(filepath.Join(t.TempDir(), "vault.db") + dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := CreateUsersTable(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterUser(db, "alice", "old", "/vaults/alice.dat"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// fakeVault records what ChangePassword does with the vault.
+type fakeVault struct {
+	prepared, saved bool
+	saveErr         error
+}
+
+func (vault *fakeVault) prepare() (func() error, error) {
+	vault.prepared = true
+	return func() error {
+		vault.saved = vault.saveErr == nil
+		return vault.saveErr
+	}, nil
+}
+
+func checkLogin(t *testing.T, db *sql.DB, password string, ok bool) {
+	t.Helper()
+	_, err := AuthenticateUser(db, "alice", password)
+	if ok && err != nil {
+		t.Errorf("login with %q failed: %v", password, err)
+	} else if !ok && err == nil {
+		t.Errorf("login with %q succeeded", password)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	db := newTestDB(t, "")
+	vault := &fakeVault{}
+
+	if err := ChangePassword(db, "alice", "old", "new", vault.prepare); err != nil {
+		t.Fatal(err)
+	}
+	if !vault.saved {
+		t.Error("vault was not saved")
+	}
+	checkLogin(t, db, "new", true)
+	checkLogin(t, db, "old", false)
+}
+
+func TestChangePasswordWrongPassword(t *testing.T) {
+	db := newTestDB(t, "")
+	vault := &fakeVault{}
+
+	if err := ChangePassword(db, "alice", "wrong", "new", vault.prepare); err == nil {
+		t.Fatal("changed the password with the wrong old password")
+	}
+	if vault.prepared {
+		t.Error("vault was prepared")
+	}
+	checkLogin(t, db, "old", true)
+}
+
+func TestChangePasswordCommitFails(t *testing.T) {
+	db := newTestDB(t, "?_foreign_keys=on")
+
+	// A deferred foreign key on the password hash is only checked at
+	// commit, so changing the hash makes the commit itself fail.
+	for _, query := range []string{
+		`CREATE UNIQUE INDEX users_password_hash ON users (password_hash)`,
+		`CREATE TABLE pins (hash TEXT REFERENCES users (password_hash) DEFERRABLE INITIALLY DEFERRED)`,
+		`INSERT INTO pins SELECT password_hash FROM users`,
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vault := &fakeVault{}
+	if err := ChangePassword(db, "alice", "old", "new", vault.prepare); err == nil {
+		t.Fatal("ChangePassword succeeded although the commit failed")
+	}
+	if vault.saved {
+		t.Error("vault was saved although the commit failed")
+	}
+	checkLogin(t, db, "old", true)
+	checkLogin(t, db, "new", false)
+}
+
+func TestChangePasswordVaultSaveFails(t *testing.T) {
+	db := newTestDB(t, "")
+	vault := &fakeVault{saveErr: errors.New("disk full")}
+
+	if err := ChangePassword(db, "alice", "old", "new", vault.prepare); !errors.Is(err, vault.saveErr) {
+		t.Fatalf("ChangePassword returned %v, want the save error", err)
+	}
+	checkLogin(t, db, "old", true)
+	checkLogin(t, db, "new", false)
+}
+
+// TestChangePasswordCrash stops ChangePassword between committing the new
+// hash and saving the vault, as a crash would, and checks that the vault
+// can still be moved onto the new password afterwards.
+func TestChangePasswordCrash(t *testing.T) {
+	db := newTestDB(t, "")
+	vaultPath := filepath.Join(t.TempDir(), "vault.dat")
+	created, err := vault.CreateVault(vaultPath, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created.Close()
+	v, _, err := vault.OpenVault(vaultPath, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { v.Close() }()
+
+	func() {
+		defer func() { recover() }()
+		ChangePassword(db, "alice", "old", "new", func() (func() error, error) {
+			if _, err := v.PreparePasswordChange("old", "new"); err != nil {
+				return nil, err
+			}
+			return func() error { panic("crash") }, nil
+		})
+		t.Fatal("ChangePassword returned after the crash")
+	}()
+	checkLogin(t, db, "new", true)
+	checkLogin(t, db, "old", false)
+
+	// The vault was not touched and still opens with the old password,
+	// which is what vault passwd -force needs to catch up.
+	v.Close()
+	if v, _, err = vault.OpenVault(vaultPath, "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.ChangePassword(vaultPath, "old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	v.Close()
+	if v, _, err = vault.OpenVault(vaultPath, "new"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,9 +3,11 @@ module secure-file-vault
 go 1.22.1
 
 require (
+	filippo.io/age v1.2.1
 	fyne.io/fyne/v2 v2.5.2
 	github.com/mattn/go-sqlite3 v1.14.24
 	golang.org/x/crypto v0.29.0
+	golang.org/x/term v0.26.0
 )
 
 require (
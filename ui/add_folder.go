@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"fmt"
+	"secure-file-vault/vault"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// showAddFolderDialog asks for include and exclude patterns and then adds
+// the folder at dirPath to the vault, showing progress per file.
+func showAddFolderDialog(myWindow fyne.Window, vaultPath, dirPath string) {
+	includeEntry := widget.NewEntry()
+	includeEntry.SetPlaceHolder("e.g. *.pdf, *.key (empty adds everything)")
+	excludeEntry := widget.NewEntry()
+	excludeEntry.SetPlaceHolder("e.g. .git, *.tmp")
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Folder", widget.NewLabel(dirPath)),
+		widget.NewFormItem("Include", includeEntry),
+		widget.NewFormItem("Exclude", excludeEntry),
+	}
+
+	dialog.ShowForm("Add Folder", "Add", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		progressBar := widget.NewProgressBar()
+		progressLabel := widget.NewLabel("Scanning folder...")
+		progressDialog := dialog.NewCustomWithoutButtons("Adding Folder",
+			container.NewVBox(progressLabel, progressBar), myWindow)
+		progressDialog.Show()
+
+		go func() {
+			defer progressDialog.Hide()
+
+			added, err := currentVault.AddDirectory(dirPath, vaultKey, vault.AddDirectoryOptions{
+				Include: splitPatterns(includeEntry.Text),
+				Exclude: splitPatterns(excludeEntry.Text),
+				Progress: func(done, total int, fileName string) {
+					progressBar.SetValue(float64(done) / float64(total))
+					progressLabel.SetText(fmt.Sprintf("%d of %d: %s", done, total, fileName))
+				},
+			})
+			if err != nil {
+				showErrorNotification(err.Error())
+				if len(added) == 0 {
+					return
+				}
+			}
+
+			if err := currentVault.Save(vaultPath); err != nil {
+				showErrorNotification(err.Error())
+				return
+			}
+			showSuccessNotification(fmt.Sprintf("%d files added successfully", len(added)))
+		}()
+	}, myWindow)
+}
+
+// splitPatterns splits a comma-separated list of glob patterns.
+func splitPatterns(text string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(text, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"os"
+	"path"
+	"secure-file-vault/vault"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// showExtractAgeDialog asks who to encrypt fileName for and writes it to a
+// file in the age format, so its plaintext never touches the disk.
+func showExtractAgeDialog(parent fyne.Window, fileName string) {
+	recipientsEntry := widget.NewMultiLineEntry()
+	recipientsEntry.SetPlaceHolder("age1… (one per line)")
+	passphraseEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+	items := []*widget.FormItem{
+		widget.NewFormItem("Recipients", recipientsEntry),
+		widget.NewFormItem("Or Passphrase", passphraseEntry),
+		widget.NewFormItem("Confirm Passphrase", confirmEntry),
+	}
+
+	dialog.ShowForm("Extract as age", "Extract", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		if passphraseEntry.Text != confirmEntry.Text {
+			showErrorNotification("Passphrases do not match")
+			return
+		}
+		recipients := vault.AgeRecipients{
+			Recipients: ageLines(recipientsEntry.Text),
+			Passphrase: passphraseEntry.Text,
+		}
+
+		saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil || writer == nil {
+				return
+			}
+			outputPath := writer.URI().Path()
+			err = currentVault.ExtractFileAgeTo(fileName, vaultKey, recipients, writer)
+			if closeErr := writer.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(outputPath)
+				showErrorNotification(err.Error())
+				return
+			}
+			showSuccessNotification("File extracted as age successfully")
+		}, parent)
+		saveDialog.SetFileName(path.Base(fileName) + vault.AgeExt)
+		saveDialog.Show()
+	}, parent)
+}
+
+// showImportAgeDialog asks how to decrypt the age file being read from
+// reader and adds it to dest without its .age extension. done is called
+// once the vault has been saved.
+func showImportAgeDialog(parent fyne.Window, reader fyne.URIReadCloser, vaultPath, dest string, done func()) {
+	identitiesEntry := widget.NewMultiLineEntry()
+	identitiesEntry.SetPlaceHolder("AGE-SECRET-KEY-1… (one per line)")
+	passphraseEntry := widget.NewPasswordEntry()
+	items := []*widget.FormItem{
+		widget.NewFormItem("Identities", identitiesEntry),
+		widget.NewFormItem("Or Passphrase", passphraseEntry),
+	}
+
+	dialog.ShowForm("Import age File", "Import", "Cancel", items, func(confirmed bool) {
+		defer reader.Close()
+		if !confirmed {
+			return
+		}
+		identities := vault.AgeIdentities{
+			Identities: ageLines(identitiesEntry.Text),
+			Passphrase: passphraseEntry.Text,
+		}
+
+		fileName := path.Join(dest, vault.AgeFileName(reader.URI().Name()))
+		if err := currentVault.AddAgeFile(fileName, reader, vault.Metadata{}, identities, vaultKey); err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		if err := currentVault.Save(vaultPath); err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		done()
+		showSuccessNotification("File imported successfully")
+	}, parent)
+}
+
+// ageLines splits the text of a multi-line entry into its non-empty lines.
+func ageLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,154 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"secure-file-vault/vault"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// showExportBundleDialog asks for a passphrase and a file and exports names
+// to it as a bundle. With no names the whole vault is exported.
+func showExportBundleDialog(parent fyne.Window, names []string) {
+	passphraseEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+	items := []*widget.FormItem{
+		widget.NewFormItem("Passphrase", passphraseEntry),
+		widget.NewFormItem("Confirm Passphrase", confirmEntry),
+	}
+
+	dialog.ShowForm("Export Bundle", "Export", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		passphrase := passphraseEntry.Text
+		if passphrase == "" {
+			showErrorNotification("The passphrase must not be empty")
+			return
+		}
+		if passphrase != confirmEntry.Text {
+			showErrorNotification("Passphrases do not match")
+			return
+		}
+
+		dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil || writer == nil {
+				return
+			}
+			progressBar := widget.NewProgressBarInfinite()
+			progressDialog := dialog.NewCustomWithoutButtons("Exporting Files", progressBar, parent)
+			progressDialog.Show()
+
+			go func() {
+				outputPath := writer.URI().Path()
+				exported, err := currentVault.ExportBundle(names, passphrase, vaultKey, writer)
+				if closeErr := writer.Close(); err == nil {
+					err = closeErr
+				}
+				progressDialog.Hide()
+				if err != nil {
+					os.Remove(outputPath)
+					showErrorNotification(err.Error())
+					return
+				}
+				showSuccessNotification(fmt.Sprintf("%d files exported", len(exported)))
+			}()
+		}, parent)
+	}, parent)
+}
+
+// showImportBundleDialog asks for a bundle, its passphrase and what to do
+// with names that are taken, and imports it into dest. age files are
+// handed to showImportAgeDialog instead. done is called once the vault has
+// been saved.
+func showImportBundleDialog(parent fyne.Window, vaultPath, dest string, done func()) {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		if strings.HasSuffix(reader.URI().Name(), vault.AgeExt) {
+			showImportAgeDialog(parent, reader, vaultPath, dest, done)
+			return
+		}
+
+		policies := map[string]vault.ConflictPolicy{
+			"Overwrite": vault.ConflictOverwrite,
+			"Skip":      vault.ConflictSkip,
+			"Keep both": vault.ConflictRename,
+		}
+		passphraseEntry := widget.NewPasswordEntry()
+		policySelect := widget.NewSelect([]string{"Overwrite", "Skip", "Keep both"}, nil)
+		policySelect.SetSelected("Keep both")
+		items := []*widget.FormItem{
+			widget.NewFormItem("Passphrase", passphraseEntry),
+			widget.NewFormItem("Existing Files", policySelect),
+		}
+
+		dialog.ShowForm("Import Bundle", "Import", "Cancel", items, func(confirmed bool) {
+			if !confirmed {
+				reader.Close()
+				return
+			}
+			opts := vault.ImportOptions{Dest: dest, Policy: policies[policySelect.Selected]}
+
+			progressBar := widget.NewProgressBarInfinite()
+			progressDialog := dialog.NewCustomWithoutButtons("Importing Files", progressBar, parent)
+			progressDialog.Show()
+
+			go func() {
+				defer reader.Close()
+				results, err := currentVault.ImportBundle(reader, passphraseEntry.Text, vaultKey, opts)
+				progressDialog.Hide()
+
+				// Whatever was imported before a failure is kept.
+				if len(results) > 0 {
+					if saveErr := currentVault.Save(vaultPath); saveErr != nil {
+						showErrorNotification(saveErr.Error())
+						return
+					}
+					done()
+				}
+				switch {
+				case err != nil && len(results) > 0:
+					showErrorNotification(fmt.Sprintf("%v (%d files were imported before that)", err, len(results)))
+				case err != nil:
+					showErrorNotification(err.Error())
+				default:
+					showImportResults(parent, results)
+				}
+			}()
+		}, parent)
+	}, parent)
+}
+
+// showImportResults lists what happened to each file of a bundle.
+func showImportResults(parent fyne.Window, results []vault.ImportResult) {
+	failed := 0
+	var lines []string
+	for _, result := range results {
+		line := fmt.Sprintf("%s: %s", result.Name, result.Action)
+		if result.Err != nil {
+			failed++
+			line += fmt.Sprintf(" (%v)", result.Err)
+		} else if result.Action != vault.ExtractSkipped {
+			line += fmt.Sprintf(" -> %s", result.Path)
+		}
+		lines = append(lines, line)
+	}
+
+	if failed == 0 {
+		showSuccessNotification(fmt.Sprintf("%d files imported", len(results)))
+	} else {
+		showErrorNotification(fmt.Sprintf("%d of %d files could not be imported", failed, len(results)))
+	}
+
+	details := widget.NewLabel(strings.Join(lines, "\n"))
+	scroll := container.NewVScroll(details)
+	scroll.SetMinSize(fyne.NewSize(450, 250))
+	dialog.ShowCustom("Import Results", "Close", scroll, parent)
+}
@@ -0,0 +1,66 @@
+package ui
+
+import (
+	"database/sql"
+	"fmt"
+	"secure-file-vault/db"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+func showChangePasswordDialog(dbConn *sql.DB, myWindow fyne.Window, vaultPath, username string) {
+	oldPasswordEntry := widget.NewPasswordEntry()
+	newPasswordEntry := widget.NewPasswordEntry()
+	confirmPasswordEntry := widget.NewPasswordEntry()
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Current Password", oldPasswordEntry),
+		widget.NewFormItem("New Password", newPasswordEntry),
+		widget.NewFormItem("Confirm Password", confirmPasswordEntry),
+	}
+
+	dialog.ShowForm("Change Password", "Change", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		oldPassword := oldPasswordEntry.Text
+		newPassword := newPasswordEntry.Text
+
+		if newPassword == "" {
+			showErrorNotification("New password must not be empty")
+			return
+		}
+		if newPassword != confirmPasswordEntry.Text {
+			showErrorNotification("Passwords do not match")
+			return
+		}
+
+		// bcrypt and deriving the new vault key take a while, so they run
+		// in the background.
+		progressBar := widget.NewProgressBarInfinite()
+		progressDialog := dialog.NewCustomWithoutButtons("Changing Password", progressBar, myWindow)
+		progressDialog.Show()
+
+		vlt := currentVault
+		go func() {
+			err := db.ChangePassword(dbConn, username, oldPassword, newPassword, func() (func() error, error) {
+				change, err := vlt.PreparePasswordChange(oldPassword, newPassword)
+				if err != nil {
+					return nil, err
+				}
+				return func() error {
+					return change.Save(vaultPath)
+				}, nil
+			})
+			progressDialog.Hide()
+			if err != nil {
+				showErrorNotification(fmt.Sprintf("Failed to change password: %v", err))
+				return
+			}
+			showSuccessNotification("Password changed successfully")
+		}()
+	}, myWindow)
+}
@@ -0,0 +1,190 @@
+package ui
+
+import (
+	"path"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// nameCell is the name column of a row in the Files window. Double-clicking
+// it renames the entry in place, and dragging it onto a folder moves the
+// entry there.
+type nameCell struct {
+	widget.BaseWidget
+	browser *fileBrowser
+	uid     string
+	label   *widget.Label
+	entry   *nameEntry
+
+	dragging bool
+	drag     fyne.Position
+}
+
+func newNameCell(browser *fileBrowser) *nameCell {
+	cell := &nameCell{browser: browser, label: widget.NewLabel("")}
+	cell.label.Truncation = fyne.TextTruncateEllipsis
+	cell.entry = newNameEntry(cell.finishRename)
+	cell.entry.Hide()
+	cell.ExtendBaseWidget(cell)
+	browser.cells = append(browser.cells, cell)
+	return cell
+}
+
+func (cell *nameCell) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(container.NewStack(cell.label, cell.entry))
+}
+
+// bind shows uid in the cell, which the tree reuses for different rows.
+func (cell *nameCell) bind(uid string, text string) {
+	if cell.uid != uid {
+		cell.entry.Hide()
+		cell.label.Show()
+	}
+	cell.uid = uid
+	cell.label.SetText(text)
+}
+
+func (cell *nameCell) Tapped(*fyne.PointEvent) {
+	cell.browser.tree.Select(cell.uid)
+}
+
+func (cell *nameCell) DoubleTapped(*fyne.PointEvent) {
+	cell.browser.tree.Select(cell.uid)
+	cell.entry.SetText(path.Base(cell.uid))
+	cell.label.Hide()
+	cell.entry.Show()
+	if canvas := fyne.CurrentApp().Driver().CanvasForObject(cell); canvas != nil {
+		canvas.Focus(cell.entry)
+	}
+}
+
+// finishRename is called when editing the name ends, with ok false if it
+// was cancelled.
+func (cell *nameCell) finishRename(name string, ok bool) {
+	cell.entry.Hide()
+	cell.label.Show()
+	if !ok || name == "" || name == path.Base(cell.uid) {
+		return
+	}
+	if cell.browser.onRename != nil {
+		cell.browser.onRename(cell.uid, path.Join(parentDir(cell.uid), name))
+	}
+}
+
+func (cell *nameCell) Dragged(event *fyne.DragEvent) {
+	if !cell.dragging {
+		cell.dragging = true
+		cell.drag = event.AbsolutePosition.Subtract(event.Dragged)
+	}
+	cell.drag = cell.drag.Add(event.Dragged)
+	cell.browser.highlightDropTarget(cell.browser.dropTarget(cell.drag, cell.uid))
+}
+
+func (cell *nameCell) DragEnd() {
+	target := cell.browser.dropTarget(cell.drag, cell.uid)
+	cell.dragging = false
+	cell.browser.highlightDropTarget(nil)
+	if target != nil && cell.browser.onMove != nil {
+		cell.browser.onMove(cell.browser.dragSources(cell.uid), dropDir(target))
+	}
+}
+
+// contains reports whether the absolute position pos is over the cell.
+func (cell *nameCell) contains(pos fyne.Position) bool {
+	if !cell.Visible() {
+		return false
+	}
+	origin := fyne.CurrentApp().Driver().AbsolutePositionForObject(cell)
+	size := cell.Size()
+	return pos.X >= origin.X && pos.X < origin.X+size.Width &&
+		pos.Y >= origin.Y && pos.Y < origin.Y+size.Height
+}
+
+// dropTarget returns the row under pos that source can be dropped on: a
+// folder, or a file standing for the folder it is in.
+func (browser *fileBrowser) dropTarget(pos fyne.Position, source string) *nameCell {
+	for _, cell := range browser.cells {
+		if cell.uid == "" || cell.uid == source || !cell.contains(pos) {
+			continue
+		}
+		dir := dropDir(cell)
+		if dir == parentDir(source) || dir == source || strings.HasPrefix(dir, source+"/") {
+			return nil
+		}
+		return cell
+	}
+	return nil
+}
+
+// dropDir is the folder an entry dropped on cell is moved into.
+func dropDir(cell *nameCell) string {
+	if cell.browser.data.isDir(cell.uid) {
+		return cell.uid
+	}
+	return parentDir(cell.uid)
+}
+
+// dragSources is what dragging uid moves: the checked files if uid is one
+// of them, otherwise uid alone.
+func (browser *fileBrowser) dragSources(uid string) []string {
+	if !browser.isChecked(uid) {
+		return []string{uid}
+	}
+	var sources []string
+	for _, item := range browser.selectedItems {
+		sources = append(sources, item.Name)
+	}
+	return sources
+}
+
+func (browser *fileBrowser) highlightDropTarget(target *nameCell) {
+	for _, cell := range browser.cells {
+		importance := widget.MediumImportance
+		if cell == target {
+			importance = widget.HighImportance
+		}
+		if cell.label.Importance != importance {
+			cell.label.Importance = importance
+			cell.label.Refresh()
+		}
+	}
+}
+
+// nameEntry edits a name in place. Enter confirms; Escape or clicking
+// elsewhere cancels.
+type nameEntry struct {
+	widget.Entry
+	done func(name string, ok bool)
+}
+
+func newNameEntry(done func(name string, ok bool)) *nameEntry {
+	entry := &nameEntry{done: done}
+	entry.ExtendBaseWidget(entry)
+	entry.OnSubmitted = func(name string) {
+		entry.finish(name, true)
+	}
+	return entry
+}
+
+func (entry *nameEntry) finish(name string, ok bool) {
+	if !entry.Visible() {
+		return
+	}
+	entry.done(name, ok)
+}
+
+func (entry *nameEntry) TypedKey(key *fyne.KeyEvent) {
+	if key.Name == fyne.KeyEscape {
+		entry.finish("", false)
+		return
+	}
+	entry.Entry.TypedKey(key)
+}
+
+func (entry *nameEntry) FocusLost() {
+	entry.Entry.FocusLost()
+	entry.finish("", false)
+}
@@ -1,9 +1,13 @@
 package ui
 
 import (
-	"os"
-	"path/filepath"
+	"database/sql"
+	"fmt"
+	"path"
 	"secure-file-vault/vault"
+	"sort"
+	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -11,123 +15,621 @@ import (
 	"fyne.io/fyne/v2/widget"
 )
 
-func showFilesWindow(vaultPath string) {
+func showFilesWindow(dbConn *sql.DB, vaultPath, username string) {
 	filesWindow := fyne.CurrentApp().NewWindow("Files in Vault")
-	fileList, selectedItems := makeFileListContent()
+	browser := newFileBrowser()
+	selectedItems := &browser.selectedItems
+
+	// saveAndReload saves the vault after a change and shows the result.
+	saveAndReload := func(message string) {
+		if err := currentVault.Save(vaultPath); err != nil {
+			showErrorNotification(err.Error())
+		} else {
+			showSuccessNotification(message)
+		}
+		*selectedItems = []vault.FileInfo{}
+		browser.reload()
+	}
 
 	extractButton := widget.NewButton("Extract", func() {
-		if len(*selectedItems) == 0 {
-			showErrorNotification("No file selected for extraction")
-			return
+		// Checked files are extracted on their own; with nothing checked,
+		// the folder being viewed is extracted with its structure.
+		var fileNames []string
+		for _, fileItem := range *selectedItems {
+			fileNames = append(fileNames, fileItem.Name)
 		}
+		dirPath := browser.location()
+
 		dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
 			if err == nil && uri != nil {
 				outputDir := uri.Path()
-				progressBar := widget.NewProgressBarInfinite()
-				progressDialog := dialog.NewCustomWithoutButtons("Extracting Files", progressBar, filesWindow)
-				progressDialog.Show()
-
-				go func() {
-					defer progressDialog.Hide()
-					for _, fileItem := range *selectedItems {
-						outputPath := filepath.Join(outputDir, fileItem.Name)
-						data, err := currentVault.ExtractFile(fileItem.Name, vaultKey, outputPath)
-						if err != nil {
-							showErrorNotification(err.Error())
-							continue
-						}
+				showExtractDialog(filesWindow, func(policy vault.ConflictPolicy) {
+					progressBar := widget.NewProgressBarInfinite()
+					progressDialog := dialog.NewCustomWithoutButtons("Extracting Files", progressBar, filesWindow)
+					progressDialog.Show()
 
-						err = os.WriteFile(outputPath, data, 0644)
+					go func() {
+						var results []vault.ExtractResult
+						var err error
+						if len(fileNames) > 0 {
+							results, err = currentVault.ExtractFiles(fileNames, outputDir, vaultKey, policy)
+						} else {
+							results, err = currentVault.ExtractTree(dirPath, outputDir, vaultKey, policy)
+						}
+						progressDialog.Hide()
 						if err != nil {
 							showErrorNotification(err.Error())
-							continue
+							return
 						}
 
-						go watchFileForChanges(outputPath, vaultPath, vaultKey, currentVault)
-					}
-					showSuccessNotification("Files extracted successfully")
+						for _, result := range results {
+							if result.Err == nil && result.Action != vault.ExtractSkipped {
+								go watchFileForChanges(result.Path, result.Name, vaultPath, vaultKey, currentVault)
+							}
+						}
 
-					*selectedItems = []vault.FileEntry{}
-					fileList.Refresh()
-					filesWindow.Content().Refresh()
-				}()
+						// The selection belongs to the window's event
+						// goroutine, and fyne 2.5 has no way to post back to
+						// it, so it is cleared when the results are closed.
+						showExtractResults(filesWindow, results, func() {
+							*selectedItems = []vault.FileInfo{}
+							browser.tree.Refresh()
+						})
+					}()
+				})
 			}
 		}, filesWindow)
 	})
 
+	ageButton := widget.NewButton("Extract as age…", func() {
+		if _, ok := browser.data.files[browser.selected]; !ok {
+			showErrorNotification("No file selected")
+			return
+		}
+		showExtractAgeDialog(filesWindow, browser.selected)
+	})
+
+	openButton := widget.NewButton("Open Temporarily", func() {
+		if _, ok := browser.data.files[browser.selected]; !ok {
+			showErrorNotification("No file selected")
+			return
+		}
+		openTemporarily(vaultPath, browser.selected)
+	})
+
+	exportButton := widget.NewButton("Export…", func() {
+		// Like Extract: the checked files, or else the folder being viewed,
+		// which at the top is the whole vault.
+		var names []string
+		for _, fileItem := range *selectedItems {
+			names = append(names, fileItem.Name)
+		}
+		if len(names) == 0 && browser.location() != "" {
+			names = []string{browser.location()}
+		}
+		showExportBundleDialog(filesWindow, names)
+	})
+
+	shareButton := widget.NewButton("Share…", func() {
+		var names []string
+		for _, fileItem := range *selectedItems {
+			names = append(names, fileItem.Name)
+		}
+		if len(names) == 0 && browser.selected != "" {
+			names = []string{browser.selected}
+		}
+		if len(names) == 0 {
+			showErrorNotification("No file selected for sharing")
+			return
+		}
+		showShareDialog(filesWindow, dbConn, username, names)
+	})
+
+	importButton := widget.NewButton("Import…", func() {
+		showImportBundleDialog(filesWindow, vaultPath, browser.location(), browser.reload)
+	})
+
+	// trashed saves after entries were moved to the trash and offers to
+	// put them back.
+	trashed := func(message string, indexes []uint64) {
+		saveAndReload(message)
+		showUndoToast(filesWindow, message, func() {
+			for _, index := range indexes {
+				if err := currentVault.RestoreFromTrash(index, vaultKey); err != nil {
+					showErrorNotification(err.Error())
+				}
+			}
+			saveAndReload("Restored from trash")
+		})
+	}
+
+	// Files are renamed with RenameFile so that a folder is never renamed
+	// by mistake in their place.
+	browser.onRename = func(oldPath, newPath string) {
+		rename := currentVault.RenameFile
+		if browser.data.isDir(oldPath) {
+			rename = currentVault.Rename
+		}
+		if err := rename(oldPath, newPath, vaultKey); err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		browser.selected = ""
+		saveAndReload("Renamed successfully")
+	}
+	browser.onMove = func(sources []string, destDir string) {
+		for _, source := range sources {
+			if err := currentVault.Move(source, destDir, vaultKey); err != nil {
+				showErrorNotification(err.Error())
+				break
+			}
+		}
+		browser.selected = ""
+		saveAndReload("Moved successfully")
+	}
+
 	removeButton := widget.NewButton("Remove", func() {
 		if len(*selectedItems) == 0 {
+			if browser.data.isDir(browser.selected) {
+				dir := browser.selected
+				dialog.ShowConfirm("Remove Folder",
+					fmt.Sprintf("Move %s and everything in it to the trash?", dir),
+					func(confirmed bool) {
+						if !confirmed {
+							return
+						}
+						var indexes []uint64
+						for name, fileItem := range browser.data.files {
+							if strings.HasPrefix(name, dir+"/") {
+								indexes = append(indexes, fileItem.Index)
+							}
+						}
+						// Restoring the files brings back the empty folders
+						// removed with them. A folder holding no files at all
+						// leaves nothing in the trash, so undo creates its
+						// innermost folders again instead.
+						var leaves []string
+						for name, children := range browser.data.children {
+							if (name == dir || strings.HasPrefix(name, dir+"/")) && len(children) == 0 {
+								leaves = append(leaves, name)
+							}
+						}
+						if err := currentVault.RemoveDir(dir, vaultKey); err != nil {
+							showErrorNotification(err.Error())
+							return
+						}
+						browser.selected = ""
+						if len(indexes) > 0 {
+							trashed("Folder moved to trash", indexes)
+							return
+						}
+						saveAndReload("Folder removed")
+						showUndoToast(filesWindow, "Folder removed", func() {
+							for _, leaf := range leaves {
+								if err := currentVault.Mkdir(leaf, vaultKey); err != nil {
+									showErrorNotification(err.Error())
+								}
+							}
+							saveAndReload("Folder restored")
+						})
+					}, filesWindow)
+				return
+			}
 			showErrorNotification("No file selected for removal")
 			return
 		}
 
+		var indexes []uint64
 		for _, fileItem := range *selectedItems {
 			err := currentVault.RemoveFile(fileItem.Name, vaultKey)
 			if err != nil {
+				showErrorNotification(err.Error())
+				break
+			}
+			indexes = append(indexes, fileItem.Index)
+		}
+		if len(indexes) == 0 {
+			return
+		}
+
+		trashed(fmt.Sprintf("%d files moved to trash", len(indexes)), indexes)
+	})
+
+	trashButton := widget.NewButton("Trash", func() {
+		showTrashWindow(vaultPath, browser.reload)
+	})
+
+	newFolderButton := widget.NewButton("New Folder", func() {
+		nameEntry := widget.NewEntry()
+		items := []*widget.FormItem{widget.NewFormItem("Name", nameEntry)}
+		dialog.ShowForm("New Folder", "Create", "Cancel", items, func(confirmed bool) {
+			if !confirmed || nameEntry.Text == "" {
+				return
+			}
+			dir := path.Join(browser.location(), nameEntry.Text)
+			if err := currentVault.Mkdir(dir, vaultKey); err != nil {
 				showErrorNotification(err.Error())
 				return
 			}
+			saveAndReload("Folder created successfully")
+		}, filesWindow)
+	})
+
+	renameButton := widget.NewButton("Rename", func() {
+		oldPath := browser.selected
+		if oldPath == "" {
+			showErrorNotification("No file or folder selected for renaming")
+			return
 		}
+		nameEntry := widget.NewEntry()
+		nameEntry.SetText(path.Base(oldPath))
+		items := []*widget.FormItem{widget.NewFormItem("New Name", nameEntry)}
+		dialog.ShowForm("Rename", "Rename", "Cancel", items, func(confirmed bool) {
+			if !confirmed || nameEntry.Text == "" {
+				return
+			}
+			browser.onRename(oldPath, path.Join(parentDir(oldPath), nameEntry.Text))
+		}, filesWindow)
+	})
 
-		err := currentVault.Save(vaultPath)
+	moveButton := widget.NewButton("Move", func() {
+		var sources []string
+		for _, fileItem := range *selectedItems {
+			sources = append(sources, fileItem.Name)
+		}
+		if len(sources) == 0 && browser.selected != "" {
+			sources = []string{browser.selected}
+		}
+		if len(sources) == 0 {
+			showErrorNotification("No file selected for moving")
+			return
+		}
+
+		dirs, err := currentVault.ListDirs(vaultKey)
 		if err != nil {
 			showErrorNotification(err.Error())
 			return
 		}
+		destSelect := widget.NewSelect(append([]string{"/"}, dirs...), nil)
+		destSelect.SetSelected("/")
+		items := []*widget.FormItem{widget.NewFormItem("Move To", destSelect)}
+		dialog.ShowForm("Move", "Move", "Cancel", items, func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			browser.onMove(sources, destSelect.Selected)
+		}, filesWindow)
+	})
 
-		showSuccessNotification("Files removed successfully")
-		*selectedItems = []vault.FileEntry{}
+	detailsButton := widget.NewButton("Details", func() {
+		fileItem, ok := browser.data.files[browser.selected]
+		if !ok {
+			showErrorNotification("No file selected")
+			return
+		}
+		showFileDetails(filesWindow, fileItem, func() {
+			saveAndReload("Note saved")
+		})
+	})
 
-		fileList.Refresh()
-		filesWindow.Content().Refresh()
+	historyButton := widget.NewButton("History…", func() {
+		if _, ok := browser.data.files[browser.selected]; !ok {
+			showErrorNotification("No file selected")
+			return
+		}
+		showHistoryWindow(vaultPath, browser.selected, browser.reload)
 	})
 
-	filesContainer := container.NewBorder(nil, container.NewVBox(extractButton, removeButton), nil, nil, fileList)
+	folderButtons := container.NewGridWithColumns(5, newFolderButton, renameButton, moveButton, detailsButton, historyButton)
+	filesContainer := container.NewBorder(
+		container.NewVBox(browser.breadcrumbs, browser.header),
+		container.NewVBox(folderButtons, container.NewGridWithColumns(3, extractButton, ageButton, openButton), container.NewGridWithColumns(3, exportButton, importButton, shareButton), container.NewGridWithColumns(2, removeButton, trashButton)),
+		nil, nil,
+		browser.tree,
+	)
 	filesWindow.SetContent(filesContainer)
-	filesWindow.Resize(fyne.NewSize(500, 400))
+	filesWindow.Resize(fyne.NewSize(700, 450))
 	filesWindow.CenterOnScreen()
 	filesWindow.Show()
 }
 
-func makeFileListContent() (*widget.List, *[]vault.FileEntry) {
-	selectedItems := &[]vault.FileEntry{}
+// showFileDetails shows an entry's metadata and lets the user edit its
+// note. saved is called after the note has been changed.
+func showFileDetails(parent fyne.Window, fileItem vault.FileInfo, saved func()) {
+	meta := fileItem.Metadata
+	noteEntry := widget.NewMultiLineEntry()
+	noteEntry.SetText(meta.Note)
 
-	fileList := widget.NewList(
-		func() int {
-			files, err := currentVault.ListFiles(vaultKey)
-			if err != nil {
-				showErrorNotification(err.Error())
-				return 0
+	mode := ""
+	if meta.Mode != 0 {
+		mode = meta.Mode.String()
+	}
+	compression := "None"
+	if meta.Codec != vault.CodecNone {
+		compression = meta.Codec
+	}
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Name", widget.NewLabel(fileItem.Name)),
+		widget.NewFormItem("Size", widget.NewLabel(fmt.Sprintf("%s (%d bytes)", formatSize(meta.Size), meta.Size))),
+		widget.NewFormItem("Type", widget.NewLabel(meta.ContentType)),
+		widget.NewFormItem("Compression", widget.NewLabel(compression)),
+		widget.NewFormItem("Permissions", widget.NewLabel(mode)),
+		widget.NewFormItem("Modified on Disk", widget.NewLabel(formatTime(meta.ModTime))),
+		widget.NewFormItem("Added", widget.NewLabel(formatTime(meta.Added))),
+		widget.NewFormItem("Updated", widget.NewLabel(formatTime(meta.Updated))),
+		widget.NewFormItem("Note", noteEntry),
+	}
+
+	dialog.ShowForm("File Details", "Save", "Close", items, func(confirmed bool) {
+		if !confirmed || noteEntry.Text == meta.Note {
+			return
+		}
+		if err := currentVault.SetNote(fileItem.Name, noteEntry.Text, vaultKey); err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		saved()
+	}, parent)
+}
+
+// showExtractDialog asks what to do with files that already exist and
+// calls extract with the chosen policy.
+func showExtractDialog(parent fyne.Window, extract func(vault.ConflictPolicy)) {
+	policies := map[string]vault.ConflictPolicy{
+		"Overwrite": vault.ConflictOverwrite,
+		"Skip":      vault.ConflictSkip,
+		"Keep both": vault.ConflictRename,
+	}
+	policySelect := widget.NewSelect([]string{"Overwrite", "Skip", "Keep both"}, nil)
+	policySelect.SetSelected("Keep both")
+
+	items := []*widget.FormItem{widget.NewFormItem("Existing Files", policySelect)}
+	dialog.ShowForm("Extract", "Extract", "Cancel", items, func(confirmed bool) {
+		if confirmed {
+			extract(policies[policySelect.Selected])
+		}
+	}, parent)
+}
+
+// showExtractResults lists what happened to each extracted file and calls
+// onClosed when the list is closed.
+func showExtractResults(parent fyne.Window, results []vault.ExtractResult, onClosed func()) {
+	failed := 0
+	var lines []string
+	for _, result := range results {
+		line := fmt.Sprintf("%s: %s", result.Name, result.Action)
+		if result.Err != nil {
+			failed++
+			line += fmt.Sprintf(" (%v)", result.Err)
+		} else if result.Action != vault.ExtractSkipped {
+			line += fmt.Sprintf(" -> %s", result.Path)
+		}
+		lines = append(lines, line)
+	}
+
+	if failed == 0 {
+		showSuccessNotification(fmt.Sprintf("%d files extracted", len(results)))
+	} else {
+		showErrorNotification(fmt.Sprintf("%d of %d files could not be extracted", failed, len(results)))
+	}
+
+	details := widget.NewLabel(strings.Join(lines, "\n"))
+	scroll := container.NewVScroll(details)
+	scroll.SetMinSize(fyne.NewSize(450, 250))
+	resultsDialog := dialog.NewCustom("Extraction Results", "Close", scroll, parent)
+	resultsDialog.SetOnClosed(onClosed)
+	resultsDialog.Show()
+}
+
+// vaultTree is a snapshot of the vault's folders and files, keyed by path.
+// The root folder is "".
+type vaultTree struct {
+	children map[string][]string
+	files    map[string]vault.FileInfo
+}
+
+// The columns the Files window can sort by.
+const (
+	columnName     = "Name"
+	columnSize     = "Size"
+	columnModified = "Modified"
+	columnType     = "Type"
+)
+
+var fileColumns = []string{columnName, columnSize, columnModified, columnType}
+
+func loadVaultTree() (*vaultTree, error) {
+	files, err := currentVault.List(vaultKey)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := currentVault.ListDirs(vaultKey)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &vaultTree{
+		children: map[string][]string{"": {}},
+		files:    make(map[string]vault.FileInfo, len(files)),
+	}
+	for _, dir := range dirs {
+		data.children[dir] = []string{}
+	}
+	for _, dir := range dirs {
+		parent := parentDir(dir)
+		data.children[parent] = append(data.children[parent], dir)
+	}
+	for _, file := range files {
+		data.files[file.Name] = file
+		parent := parentDir(file.Name)
+		data.children[parent] = append(data.children[parent], file.Name)
+	}
+
+	data.sort(columnName, false)
+	return data, nil
+}
+
+// sort orders each folder's contents by column. Folders are always listed
+// before files, and sorted by name.
+func (data *vaultTree) sort(column string, descending bool) {
+	for _, children := range data.children {
+		sort.SliceStable(children, func(i, j int) bool {
+			a, b := children[i], children[j]
+			aDir, bDir := data.isDir(a), data.isDir(b)
+			if aDir || bDir {
+				if aDir != bDir {
+					return aDir
+				}
+				return a < b
+			}
+			if descending {
+				a, b = b, a
+			}
+
+			aMeta, bMeta := data.files[a].Metadata, data.files[b].Metadata
+			switch column {
+			case columnSize:
+				if aMeta.Size != bMeta.Size {
+					return aMeta.Size < bMeta.Size
+				}
+			case columnModified:
+				if !modified(aMeta).Equal(modified(bMeta)) {
+					return modified(aMeta).Before(modified(bMeta))
+				}
+			case columnType:
+				if aMeta.ContentType != bMeta.ContentType {
+					return aMeta.ContentType < bMeta.ContentType
+				}
 			}
-			return len(files)
+			return a < b
+		})
+	}
+}
+
+// modified is when the file was last changed, on disk before it was added
+// or in the vault since.
+func modified(meta vault.Metadata) time.Time {
+	if !meta.Updated.Equal(meta.Added) {
+		return meta.Updated
+	}
+	if !meta.ModTime.IsZero() {
+		return meta.ModTime
+	}
+	return meta.Added
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func (data *vaultTree) isDir(uid string) bool {
+	_, ok := data.children[uid]
+	return ok
+}
+
+func parentDir(name string) string {
+	if dir := path.Dir(name); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// fileBrowser shows the vault as a tree rooted at currentDir, with
+// breadcrumbs leading back up to the vault root.
+type fileBrowser struct {
+	tree          *widget.Tree
+	breadcrumbs   *fyne.Container
+	header        *fyne.Container
+	data          *vaultTree
+	sortColumn    string
+	sortDesc      bool
+	currentDir    string
+	selected      string
+	selectedItems []vault.FileInfo
+
+	// cells are the name cells of the tree's rows, for finding where an
+	// entry is dropped.
+	cells []*nameCell
+	// onRename and onMove are called when an entry is renamed in place or
+	// dropped on a folder.
+	onRename func(oldPath, newPath string)
+	onMove   func(sources []string, destDir string)
+}
+
+func newFileBrowser() *fileBrowser {
+	browser := &fileBrowser{
+		data:        &vaultTree{children: map[string][]string{"": {}}},
+		breadcrumbs: container.NewHBox(),
+		header:      container.NewGridWithColumns(len(fileColumns)),
+		sortColumn:  columnName,
+	}
+
+	browser.tree = widget.NewTree(
+		func(uid widget.TreeNodeID) []widget.TreeNodeID {
+			if uid == "" {
+				uid = browser.currentDir
+			}
+			return browser.data.children[uid]
 		},
-		func() fyne.CanvasObject {
-			return container.NewHBox(
-				widget.NewCheck("", nil),
-				widget.NewLabel(""),
-			)
+		func(uid widget.TreeNodeID) bool {
+			return uid == "" || browser.data.isDir(uid)
 		},
-		func(i widget.ListItemID, o fyne.CanvasObject) {
-			files, err := currentVault.ListFiles(vaultKey)
-			if err != nil {
-				showErrorNotification(err.Error())
-				return
+		func(branch bool) fyne.CanvasObject {
+			columns := container.NewGridWithColumns(len(fileColumns), newNameCell(browser))
+			for range fileColumns[1:] {
+				label := widget.NewLabel("")
+				label.Truncation = fyne.TextTruncateEllipsis
+				columns.Add(label)
 			}
-			fileItem := files[i]
-
-			check := o.(*fyne.Container).Objects[0].(*widget.Check)
-			label := o.(*fyne.Container).Objects[1].(*widget.Label)
+			return container.NewBorder(nil, nil, widget.NewCheck("", nil), nil, columns)
+		},
+		func(uid widget.TreeNodeID, branch bool, o fyne.CanvasObject) {
+			row := o.(*fyne.Container)
+			columns := row.Objects[0].(*fyne.Container).Objects
+			check := row.Objects[1].(*widget.Check)
+			name := columns[0].(*nameCell)
 
-			label.SetText(fileItem.Name)
-			check.SetChecked(false)
+			check.OnChanged = nil
+			if branch {
+				check.Hide()
+				name.bind(uid, path.Base(uid)+"/")
+				for _, column := range columns[1:] {
+					column.(*widget.Label).SetText("")
+				}
+				return
+			}
+			check.Show()
+			name.bind(uid, path.Base(uid))
 
+			fileItem := browser.data.files[uid]
+			columns[1].(*widget.Label).SetText(formatSize(fileItem.Metadata.Size))
+			columns[2].(*widget.Label).SetText(formatTime(modified(fileItem.Metadata)))
+			columns[3].(*widget.Label).SetText(fileItem.Metadata.ContentType)
+			check.SetChecked(browser.isChecked(uid))
 			check.OnChanged = func(checked bool) {
 				if checked {
-					*selectedItems = append(*selectedItems, fileItem)
+					browser.selectedItems = append(browser.selectedItems, fileItem)
 				} else {
-					for index, item := range *selectedItems {
+					for index, item := range browser.selectedItems {
 						if item.Name == fileItem.Name {
-							*selectedItems = append((*selectedItems)[:index], (*selectedItems)[index+1:]...)
+							browser.selectedItems = append(browser.selectedItems[:index], browser.selectedItems[index+1:]...)
 							break
 						}
 					}
@@ -135,6 +637,121 @@ func makeFileListContent() (*widget.List, *[]vault.FileEntry) {
 			}
 		},
 	)
+	browser.tree.OnSelected = func(uid widget.TreeNodeID) {
+		browser.selected = uid
+		browser.refreshBreadcrumbs()
+	}
+	browser.tree.OnUnselected = func(uid widget.TreeNodeID) {
+		browser.selected = ""
+		browser.refreshBreadcrumbs()
+	}
+
+	browser.refreshHeader()
+	browser.reload()
+	return browser
+}
+
+// refreshHeader shows a button per column that sorts by it, or reverses
+// the order if it is already sorted by that column.
+func (browser *fileBrowser) refreshHeader() {
+	browser.header.RemoveAll()
+	for _, column := range fileColumns {
+		column := column
+		text := column
+		if column == browser.sortColumn {
+			text += " ▲"
+			if browser.sortDesc {
+				text = column + " ▼"
+			}
+		}
+		browser.header.Add(widget.NewButton(text, func() {
+			if browser.sortColumn == column {
+				browser.sortDesc = !browser.sortDesc
+			} else {
+				browser.sortColumn, browser.sortDesc = column, false
+			}
+			browser.data.sort(browser.sortColumn, browser.sortDesc)
+			browser.refreshHeader()
+			browser.tree.Refresh()
+		}))
+	}
+}
+
+func (browser *fileBrowser) isChecked(name string) bool {
+	for _, item := range browser.selectedItems {
+		if item.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// location is the folder the user is looking at: the selected folder, the
+// folder of the selected file, or the tree's root.
+func (browser *fileBrowser) location() string {
+	switch {
+	case browser.selected == "":
+		return browser.currentDir
+	case browser.data.isDir(browser.selected):
+		return browser.selected
+	default:
+		return parentDir(browser.selected)
+	}
+}
+
+// setDir re-roots the tree at dir.
+func (browser *fileBrowser) setDir(dir string) {
+	browser.currentDir = dir
+	browser.selected = ""
+	browser.tree.UnselectAll()
+	browser.tree.Refresh()
+	browser.refreshBreadcrumbs()
+}
+
+// reload reads the vault again, keeping the current folder if it still
+// exists.
+func (browser *fileBrowser) reload() {
+	data, err := loadVaultTree()
+	if err != nil {
+		showErrorNotification(err.Error())
+		return
+	}
+	data.sort(browser.sortColumn, browser.sortDesc)
+	browser.data = data
+	if !data.isDir(browser.currentDir) {
+		browser.currentDir = ""
+	}
+	if _, ok := data.files[browser.selected]; !ok && !data.isDir(browser.selected) {
+		browser.selected = ""
+	}
+	browser.tree.Refresh()
+	browser.refreshBreadcrumbs()
+}
+
+func (browser *fileBrowser) refreshBreadcrumbs() {
+	browser.breadcrumbs.RemoveAll()
+	browser.breadcrumbs.Add(widget.NewButton("Vault", func() {
+		browser.setDir("")
+	}))
+
+	location := browser.location()
+	if location == "" {
+		return
+	}
+	for _, dir := range append(parentDirs(location), location) {
+		dir := dir
+		browser.breadcrumbs.Add(widget.NewLabel("/"))
+		browser.breadcrumbs.Add(widget.NewButton(path.Base(dir), func() {
+			browser.setDir(dir)
+		}))
+	}
+}
 
-	return fileList, selectedItems
+// parentDirs returns every folder above name, outermost first.
+func parentDirs(name string) []string {
+	var dirs []string
+	for dir := parentDir(name); dir != ""; dir = parentDir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+	return dirs
 }
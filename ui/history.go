@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"secure-file-vault/vault"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// showHistoryWindow lists the versions of a vault entry, newest first,
+// and lets the user extract or restore any of them.
+func showHistoryWindow(vaultPath, fileName string, restored func()) {
+	historyWindow := fyne.CurrentApp().NewWindow("History of " + fileName)
+
+	var versions []vault.VersionInfo
+	load := func() bool {
+		list, err := currentVault.Versions(fileName, vaultKey)
+		if err != nil {
+			showErrorNotification(err.Error())
+			return false
+		}
+		versions = make([]vault.VersionInfo, 0, len(list))
+		for i := len(list) - 1; i >= 0; i-- {
+			versions = append(versions, list[i])
+		}
+		return true
+	}
+	if !load() {
+		return
+	}
+
+	var versionList *widget.List
+	versionList = widget.NewList(
+		func() int {
+			return len(versions)
+		},
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil,
+				container.NewHBox(widget.NewButton("Extract", nil), widget.NewButton("Restore", nil)),
+				widget.NewLabel(""),
+			)
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			version := versions[i]
+			row := o.(*fyne.Container)
+			label := row.Objects[0].(*widget.Label)
+			buttons := row.Objects[1].(*fyne.Container).Objects
+			extractButton := buttons[0].(*widget.Button)
+			restoreButton := buttons[1].(*widget.Button)
+
+			label.SetText(describeVersion(version, versions[0]))
+
+			extractButton.OnTapped = func() {
+				dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+					if err != nil || writer == nil {
+						return
+					}
+					outputPath := writer.URI().Path()
+					err = currentVault.ExtractVersionTo(fileName, version.ID, vaultKey, writer)
+					if closeErr := writer.Close(); err == nil {
+						err = closeErr
+					}
+					if err != nil {
+						os.Remove(outputPath)
+						showErrorNotification(err.Error())
+						return
+					}
+					showSuccessNotification("Version extracted successfully")
+				}, historyWindow)
+			}
+
+			if version.Current {
+				restoreButton.Disable()
+				return
+			}
+			restoreButton.Enable()
+			restoreButton.OnTapped = func() {
+				if err := currentVault.RestoreVersion(fileName, version.ID, vaultKey); err != nil {
+					showErrorNotification(err.Error())
+					return
+				}
+				if err := currentVault.Save(vaultPath); err != nil {
+					showErrorNotification(err.Error())
+					return
+				}
+				showSuccessNotification("Version restored successfully")
+				load()
+				versionList.Refresh()
+				restored()
+			}
+		},
+	)
+
+	historyWindow.SetContent(versionList)
+	historyWindow.Resize(fyne.NewSize(650, 300))
+	historyWindow.CenterOnScreen()
+	historyWindow.Show()
+}
+
+// describeVersion summarises a version and how it differs from the
+// current one.
+func describeVersion(version, current vault.VersionInfo) string {
+	hash := version.Hash
+	if len(hash) > 8 {
+		hash = hash[:8]
+	}
+
+	text := fmt.Sprintf("#%s  %s  %s  %s", version.ID, formatTime(version.Updated), formatSize(version.Size), hash)
+	switch {
+	case version.Current:
+		text += "  (current)"
+	case version.Hash == current.Hash:
+		text += "  (same content as current)"
+	default:
+		diff := version.Size - current.Size
+		sign := "+"
+		if diff < 0 {
+			sign, diff = "-", -diff
+		}
+		text += fmt.Sprintf("  (%s%s vs current)", sign, formatSize(diff))
+	}
+	return text
+}
@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"fmt"
+	"secure-file-vault/vault"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// checkVaultIntegrity verifies the whole vault in the background and shows
+// what it found.
+func checkVaultIntegrity(myWindow fyne.Window, vaultPath string) {
+	progressBar := widget.NewProgressBarInfinite()
+	progressDialog := dialog.NewCustomWithoutButtons("Checking Vault Integrity", progressBar, myWindow)
+	progressDialog.Show()
+
+	go func() {
+		report, err := currentVault.Verify(vaultKey)
+		progressDialog.Hide()
+		if err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		if report.OK() {
+			dialog.ShowInformation("Vault Integrity",
+				fmt.Sprintf("No problems found in %d files, %d in trash, %d stored versions.", report.Files, report.Trashed, report.Bodies),
+				myWindow)
+			return
+		}
+		showIntegrityProblems(myWindow, vaultPath, report)
+	}()
+}
+
+// showIntegrityProblems lists the problems in report and offers to move
+// the bad entries to quarantine.
+func showIntegrityProblems(myWindow fyne.Window, vaultPath string, report vault.VerifyReport) {
+	var lines []string
+	for _, problem := range report.Problems {
+		lines = append(lines, problem.String())
+	}
+
+	details := widget.NewLabel(strings.Join(lines, "\n"))
+	details.Wrapping = fyne.TextWrapWord
+	scroll := container.NewVScroll(details)
+	scroll.SetMinSize(fyne.NewSize(500, 250))
+	content := container.NewBorder(
+		widget.NewLabel(fmt.Sprintf("%d problems found. Repairing moves damaged files to quarantine and deletes stored data nothing refers to.", len(report.Problems))),
+		nil, nil, nil,
+		scroll,
+	)
+
+	dialog.ShowCustomConfirm("Vault Integrity", "Repair", "Close", content, func(repair bool) {
+		if !repair {
+			return
+		}
+		repaired, err := currentVault.Repair(vaultKey)
+		if err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		if repaired.Repaired {
+			if err := currentVault.Save(vaultPath); err != nil {
+				showErrorNotification(err.Error())
+				return
+			}
+		}
+		showSuccessNotification(fmt.Sprintf("Repaired %d problems", len(repaired.Problems)))
+	}, myWindow)
+}
@@ -2,6 +2,8 @@ package ui
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"path/filepath"
 	"secure-file-vault/db"
 	"secure-file-vault/vault"
@@ -9,6 +11,7 @@ import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 )
@@ -49,6 +52,15 @@ func makeLoginScreen(dbConn *sql.DB, myWindow fyne.Window) fyne.CanvasObject {
 		}
 
 		vlt, key, err := vault.OpenVault(vaultPath, password)
+		var lockedErr *vault.LockedError
+		if errors.As(err, &lockedErr) {
+			offerReadOnly(dbConn, myWindow, vaultPath, username, password, lockedErr)
+			return
+		}
+		if errors.Is(err, vault.ErrVaultCorrupted) {
+			offerBackup(dbConn, myWindow, vaultPath, username, password)
+			return
+		}
 		if err != nil {
 			fyne.CurrentApp().SendNotification(&fyne.Notification{
 				Title:   "Error",
@@ -80,3 +92,59 @@ func makeLoginScreen(dbConn *sql.DB, myWindow fyne.Window) fyne.CanvasObject {
 		layout.NewSpacer(),
 	)
 }
+
+// offerBackup asks whether to open the newest valid backup of a vault file
+// that failed to decode. The restored vault is saved straight away, which
+// puts it back in place of the damaged file.
+func offerBackup(dbConn *sql.DB, myWindow fyne.Window, vaultPath, username, password string) {
+	dialog.ShowConfirm(
+		"Vault Damaged",
+		"The vault file could not be read. Would you like to open the newest valid backup instead?",
+		func(restore bool) {
+			if !restore {
+				return
+			}
+
+			vlt, key, backupPath, err := vault.OpenBackup(vaultPath, password)
+			if err != nil {
+				showErrorNotification(err.Error())
+				return
+			}
+			if err := vlt.Save(vaultPath); err != nil {
+				showErrorNotification(fmt.Sprintf("Failed to restore vault: %v", err))
+				return
+			}
+
+			currentVault = vlt
+			vaultKey = key
+			showSuccessNotification(fmt.Sprintf("Vault restored from %s", filepath.Base(backupPath)))
+			myWindow.SetContent(makeMainScreen(dbConn, myWindow, vaultPath, username))
+		},
+		myWindow,
+	)
+}
+
+// offerReadOnly tells the user who holds the vault open and offers to open
+// it read-only instead.
+func offerReadOnly(dbConn *sql.DB, myWindow fyne.Window, vaultPath, username, password string, lockedErr *vault.LockedError) {
+	dialog.ShowConfirm(
+		"Vault In Use",
+		fmt.Sprintf("The vault is already open by %s.\nWould you like to open it read-only?", lockedErr.Holder),
+		func(readOnly bool) {
+			if !readOnly {
+				return
+			}
+
+			vlt, key, err := vault.OpenVaultReadOnly(vaultPath, password)
+			if err != nil {
+				showErrorNotification(err.Error())
+				return
+			}
+
+			currentVault = vlt
+			vaultKey = key
+			myWindow.SetContent(makeMainScreen(dbConn, myWindow, vaultPath, username))
+		},
+		myWindow,
+	)
+}
@@ -6,6 +6,7 @@ import (
 	"image/color"
 	"os"
 	"path/filepath"
+	"secure-file-vault/vault"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -17,11 +18,16 @@ import (
 
 func makeMainScreen(dbConn *sql.DB, myWindow fyne.Window, vaultPath, username string) fyne.CanvasObject {
 
+	setUpSharing(dbConn, vaultPath, username)
+
 	logo := canvas.NewImageFromResource(Resources["logoText_png"])
 	logo.SetMinSize(fyne.NewSize(150, 200))
 	logo.FillMode = canvas.ImageFillContain
 
 	vaultStatus := canvas.NewText("Vault Status: Unlocked", color.RGBA{R: 0, G: 128, B: 0, A: 255})
+	if currentVault.ReadOnly() {
+		vaultStatus = canvas.NewText("Vault Status: Read-only", color.RGBA{R: 200, G: 120, B: 0, A: 255})
+	}
 	vaultStatus.TextStyle = fyne.TextStyle{Bold: true}
 	vaultStatusContainer := container.NewHBox(container.NewPadded(vaultStatus))
 
@@ -42,13 +48,20 @@ func makeMainScreen(dbConn *sql.DB, myWindow fyne.Window, vaultPath, username st
 
 	addFileButton := widget.NewButton("Add File", func() {
 		filePath := fileEntry.Text
-		data, err := os.ReadFile(filePath)
+		file, err := os.Open(filePath)
+		if err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
 		if err != nil {
 			showErrorNotification(err.Error())
 			return
 		}
 
-		err = currentVault.AddFile(filepath.Base(filePath), data, vaultKey)
+		err = currentVault.AddFileWithMetadata(filepath.Base(filePath), file, vault.NewMetadata(info), vaultKey)
 		if err != nil {
 			showErrorNotification(err.Error())
 			return
@@ -63,11 +76,45 @@ func makeMainScreen(dbConn *sql.DB, myWindow fyne.Window, vaultPath, username st
 		showSuccessNotification("File added successfully")
 	})
 
+	addFolderButton := widget.NewButton("Add Folder", func() {
+		dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err == nil && uri != nil {
+				showAddFolderDialog(myWindow, vaultPath, uri.Path())
+			}
+		}, myWindow)
+	})
+
 	viewFilesButton := widget.NewButton("View Files", func() {
-		showFilesWindow(vaultPath)
+		showFilesWindow(dbConn, vaultPath, username)
+	})
+
+	sharedButton := widget.NewButton("Shared Files", func() {
+		showSharesWindow(dbConn, vaultPath, username)
+	})
+
+	changePasswordButton := widget.NewButton("Change Password", func() {
+		showChangePasswordDialog(dbConn, myWindow, vaultPath, username)
+	})
+
+	settingsButton := widget.NewButton("Vault Settings", func() {
+		showSettingsDialog(myWindow, vaultPath)
+	})
+
+	statsButton := widget.NewButton("Storage Stats", func() {
+		showStatsDialog(myWindow)
+	})
+
+	integrityButton := widget.NewButton("Check Vault Integrity", func() {
+		checkVaultIntegrity(myWindow, vaultPath)
+	})
+
+	tempFilesButton := widget.NewButton("Temporary Files", func() {
+		showWorkspaceWindow(vaultPath)
 	})
 
 	logoutButton := widget.NewButton("Logout", func() {
+		closeWorkspace()
+		currentVault.Close()
 		currentVault = nil
 		vaultKey = nil
 		loginScreen := makeLoginScreen(dbConn, myWindow)
@@ -76,14 +123,21 @@ func makeMainScreen(dbConn *sql.DB, myWindow fyne.Window, vaultPath, username st
 
 	inputContainer := container.NewVBox(
 		fileEntry,
-		container.NewGridWithColumns(2,
+		container.NewGridWithColumns(3,
 			selectFileButton,
 			addFileButton,
+			addFolderButton,
 		),
 	)
 
 	buttonContainer := container.NewVBox(
 		viewFilesButton,
+		sharedButton,
+		changePasswordButton,
+		settingsButton,
+		statsButton,
+		integrityButton,
+		tempFilesButton,
 		logoutButton,
 	)
 
@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"secure-file-vault/vault"
+)
+
+const day = 24 * time.Hour
+
+func showSettingsDialog(myWindow fyne.Window, vaultPath string) {
+	settings := currentVault.Settings()
+
+	versionsEntry := widget.NewEntry()
+	versionsEntry.SetText(strconv.Itoa(settings.VersionsToKeep))
+	versionsEntry.SetPlaceHolder("0 keeps the default, -1 keeps none")
+
+	versionAgeEntry := widget.NewEntry()
+	versionAgeEntry.SetText(strconv.Itoa(int(settings.VersionMaxAge / day)))
+	versionAgeEntry.SetPlaceHolder("0 keeps versions forever")
+
+	trashAgeEntry := widget.NewEntry()
+	trashAgeEntry.SetText(strconv.Itoa(int(settings.TrashMaxAge / day)))
+	trashAgeEntry.SetPlaceHolder("0 keeps the trash until emptied")
+
+	openTimeoutEntry := widget.NewEntry()
+	openTimeoutEntry.SetText(strconv.Itoa(int(settings.OpenTimeout / time.Minute)))
+	openTimeoutEntry.SetPlaceHolder(fmt.Sprintf("0 uses %d minutes", int(vault.DefaultOpenTimeout/time.Minute)))
+
+	compressionSelect := widget.NewSelect([]string{"None", "gzip"}, nil)
+	compressionSelect.SetSelected("None")
+	if settings.Compression == vault.CodecGzip {
+		compressionSelect.SetSelected("gzip")
+	}
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Versions to Keep", versionsEntry),
+		widget.NewFormItem("Drop Versions After (days)", versionAgeEntry),
+		widget.NewFormItem("Empty Trash After (days)", trashAgeEntry),
+		widget.NewFormItem("Compress New Files", compressionSelect),
+		widget.NewFormItem("Close Opened Files After (minutes)", openTimeoutEntry),
+	}
+
+	dialog.ShowForm("Vault Settings", "Save", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		versions, err := strconv.Atoi(versionsEntry.Text)
+		if err != nil {
+			showErrorNotification(fmt.Sprintf("Invalid number of versions: %s", versionsEntry.Text))
+			return
+		}
+		versionDays, err := strconv.Atoi(versionAgeEntry.Text)
+		if err != nil || versionDays < 0 {
+			showErrorNotification(fmt.Sprintf("Invalid number of days: %s", versionAgeEntry.Text))
+			return
+		}
+
+		trashDays, err := strconv.Atoi(trashAgeEntry.Text)
+		if err != nil || trashDays < 0 {
+			showErrorNotification(fmt.Sprintf("Invalid number of days: %s", trashAgeEntry.Text))
+			return
+		}
+
+		openMinutes, err := strconv.Atoi(openTimeoutEntry.Text)
+		if err != nil || openMinutes < 0 {
+			showErrorNotification(fmt.Sprintf("Invalid number of minutes: %s", openTimeoutEntry.Text))
+			return
+		}
+
+		settings.VersionsToKeep = versions
+		settings.VersionMaxAge = time.Duration(versionDays) * day
+		settings.TrashMaxAge = time.Duration(trashDays) * day
+		settings.OpenTimeout = time.Duration(openMinutes) * time.Minute
+		settings.Compression = vault.CodecNone
+		if compressionSelect.Selected == "gzip" {
+			settings.Compression = vault.CodecGzip
+		}
+		if err := currentVault.SetSettings(settings, vaultKey); err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		if err := currentVault.Save(vaultPath); err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		showSuccessNotification("Settings saved")
+	}, myWindow)
+}
@@ -0,0 +1,212 @@
+package ui
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"path"
+	"secure-file-vault/db"
+	"secure-file-vault/vault"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// setUpSharing publishes the vault's public key, creating its key pair the
+// first time, and tells the user about anything shared with them while
+// they were away.
+func setUpSharing(dbConn *sql.DB, vaultPath, username string) {
+	publicKey, created, err := currentVault.PublicKey(vaultKey)
+	if err == vault.ErrNoKeyPair {
+		// A read-only vault cannot get a key pair until it is opened for
+		// writing.
+		return
+	}
+	if err != nil {
+		showErrorNotification(fmt.Sprintf("Failed to set up sharing: %v", err))
+		return
+	}
+	if created {
+		if err := currentVault.Save(vaultPath); err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+	}
+	if err := db.SetPublicKey(dbConn, username, publicKey); err != nil {
+		showErrorNotification(fmt.Sprintf("Failed to set up sharing: %v", err))
+		return
+	}
+
+	shares, err := db.ListSharesTo(dbConn, username)
+	if err == nil && len(shares) > 0 {
+		showSuccessNotification(fmt.Sprintf("%d items were shared with you", len(shares)))
+	}
+}
+
+// showShareDialog asks which user to share names with and puts them in
+// that user's inbox.
+func showShareDialog(parent fyne.Window, dbConn *sql.DB, username string, names []string) {
+	recipients, err := db.ListRecipients(dbConn, username)
+	if err != nil {
+		showErrorNotification(err.Error())
+		return
+	}
+	if len(recipients) == 0 {
+		showErrorNotification("There is nobody to share with yet")
+		return
+	}
+
+	recipientSelect := widget.NewSelect(recipients, nil)
+	recipientSelect.SetSelected(recipients[0])
+	items := []*widget.FormItem{widget.NewFormItem("Share With", recipientSelect)}
+
+	dialog.ShowForm("Share", "Share", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		recipient := recipientSelect.Selected
+		publicKey, err := db.GetPublicKey(dbConn, recipient)
+		if err != nil {
+			showErrorNotification(fmt.Sprintf("Failed to find %s's public key: %v", recipient, err))
+			return
+		}
+
+		var payload bytes.Buffer
+		shared, err := currentVault.Share(names, publicKey, vaultKey, &payload)
+		if err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		if err := db.AddShare(dbConn, username, recipient, shareName(names, shared), payload.Bytes()); err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		showSuccessNotification(fmt.Sprintf("Shared with %s", recipient))
+	}, parent)
+}
+
+// shareName describes what was shared for the recipient's inbox.
+func shareName(names, shared []string) string {
+	if len(names) == 1 {
+		return path.Base(names[0])
+	}
+	return fmt.Sprintf("%d files", len(shared))
+}
+
+// showSharesWindow lists what others shared with the user, to accept into
+// the vault or decline, and what the user shared that has not been
+// accepted yet, to revoke.
+func showSharesWindow(dbConn *sql.DB, vaultPath, username string) {
+	sharesWindow := fyne.CurrentApp().NewWindow("Shared Files")
+
+	var incoming, outgoing []db.Share
+	var incomingList, outgoingList *widget.List
+	reload := func() {
+		var err error
+		if incoming, err = db.ListSharesTo(dbConn, username); err != nil {
+			showErrorNotification(err.Error())
+		}
+		if outgoing, err = db.ListSharesFrom(dbConn, username); err != nil {
+			showErrorNotification(err.Error())
+		}
+		if incomingList != nil {
+			incomingList.Refresh()
+			outgoingList.Refresh()
+		}
+	}
+	reload()
+
+	accept := func(share db.Share) {
+		payload, err := db.GetSharePayload(dbConn, share.ID, username)
+		if err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		senderKey, err := db.GetPublicKey(dbConn, share.Sender)
+		if err != nil {
+			showErrorNotification(fmt.Sprintf("Failed to find %s's public key: %v", share.Sender, err))
+			return
+		}
+
+		opts := vault.ImportOptions{Policy: vault.ConflictRename}
+		results, err := currentVault.AcceptShare(bytes.NewReader(payload), senderKey, vaultKey, opts)
+		if err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		if err := currentVault.Save(vaultPath); err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		if err := db.DeleteShare(dbConn, share.ID, username); err != nil {
+			showErrorNotification(err.Error())
+		}
+		reload()
+		showImportResults(sharesWindow, results)
+	}
+
+	incomingList = widget.NewList(
+		func() int {
+			return len(incoming)
+		},
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil,
+				container.NewHBox(widget.NewButton("Accept", nil), widget.NewButton("Decline", nil)),
+				widget.NewLabel(""),
+			)
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			share := incoming[i]
+			row := o.(*fyne.Container)
+			label := row.Objects[0].(*widget.Label)
+			buttons := row.Objects[1].(*fyne.Container).Objects
+
+			label.SetText(fmt.Sprintf("%s  from %s  %s", share.Name, share.Sender, formatTime(share.Created.Local())))
+			buttons[0].(*widget.Button).OnTapped = func() {
+				accept(share)
+			}
+			buttons[1].(*widget.Button).OnTapped = func() {
+				if err := db.DeleteShare(dbConn, share.ID, username); err != nil {
+					showErrorNotification(err.Error())
+					return
+				}
+				reload()
+			}
+		},
+	)
+
+	outgoingList = widget.NewList(
+		func() int {
+			return len(outgoing)
+		},
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil, widget.NewButton("Revoke", nil), widget.NewLabel(""))
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			share := outgoing[i]
+			row := o.(*fyne.Container)
+			label := row.Objects[0].(*widget.Label)
+
+			label.SetText(fmt.Sprintf("%s  to %s  %s", share.Name, share.Recipient, formatTime(share.Created.Local())))
+			row.Objects[1].(*widget.Button).OnTapped = func() {
+				if err := db.DeleteShare(dbConn, share.ID, username); err != nil {
+					showErrorNotification(err.Error())
+					return
+				}
+				showSuccessNotification("Share revoked")
+				reload()
+			}
+		},
+	)
+
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Shared with me", incomingList),
+		container.NewTabItem("Shared by me", outgoingList),
+	)
+	sharesWindow.SetContent(tabs)
+	sharesWindow.Resize(fyne.NewSize(600, 350))
+	sharesWindow.CenterOnScreen()
+	sharesWindow.Show()
+}
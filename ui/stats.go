@@ -0,0 +1,31 @@
+package ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+func showStatsDialog(myWindow fyne.Window) {
+	stats, err := currentVault.Stats(vaultKey)
+	if err != nil {
+		showErrorNotification(err.Error())
+		return
+	}
+
+	form := widget.NewForm(
+		widget.NewFormItem("Files", widget.NewLabel(fmt.Sprintf("%d", stats.Files))),
+		widget.NewFormItem("Earlier Versions", widget.NewLabel(fmt.Sprintf("%d", stats.Versions))),
+		widget.NewFormItem("In Trash", widget.NewLabel(fmt.Sprintf("%d", stats.Trashed))),
+		widget.NewFormItem("Stored Bodies", widget.NewLabel(fmt.Sprintf("%d", stats.Blobs))),
+		widget.NewFormItem("Total Size", widget.NewLabel(formatSize(stats.TotalSize))),
+		widget.NewFormItem("Unique Size", widget.NewLabel(formatSize(stats.UniqueSize))),
+		widget.NewFormItem("On Disk", widget.NewLabel(formatSize(stats.StoredSize))),
+		widget.NewFormItem("Saved by Deduplication", widget.NewLabel(formatSize(stats.SavedSize))),
+		widget.NewFormItem("Compressed Bodies", widget.NewLabel(fmt.Sprintf("%d", stats.Compressed))),
+		widget.NewFormItem("Compression Ratio", widget.NewLabel(fmt.Sprintf("%.0f%% of original size", stats.CompressionRatio()*100))),
+	)
+	dialog.ShowCustom("Storage Stats", "Close", form, myWindow)
+}
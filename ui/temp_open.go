@@ -0,0 +1,192 @@
+package ui
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"secure-file-vault/vault"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// workspacePollInterval is how often files opened temporarily are checked
+// for changes and for having timed out.
+const workspacePollInterval = 2 * time.Second
+
+// workspace holds the files opened temporarily, workspaceDone stops its
+// watcher, workspaceStopped is closed once the watcher has returned, and
+// workspaceVaultPath is where the vault is saved after files are put back.
+// They are unset until a file is first opened.
+var workspace *vault.Workspace
+var workspaceDone, workspaceStopped chan struct{}
+var workspaceVaultPath string
+
+// openTemporarily decrypts fileName into the workspace and opens it with
+// the default application.
+func openTemporarily(vaultPath, fileName string) {
+	if workspace == nil {
+		ws, err := currentVault.NewWorkspace(vaultKey)
+		if err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		workspace, workspaceVaultPath = ws, vaultPath
+		workspaceDone, workspaceStopped = make(chan struct{}), make(chan struct{})
+		go watchWorkspace(currentVault, ws, vaultPath, workspaceDone, workspaceStopped)
+	}
+
+	filePath, err := workspace.Open(fileName)
+	if err != nil {
+		showErrorNotification(err.Error())
+		return
+	}
+	if err := fyne.CurrentApp().OpenURL(&url.URL{Scheme: "file", Path: filePath}); err != nil {
+		showErrorNotification(fmt.Sprintf("Failed to open %s: %v", path.Base(fileName), err))
+		return
+	}
+
+	timeout := currentVault.Settings().OpenTimeoutOrDefault()
+	showSuccessNotification(fmt.Sprintf("%s is open until you close it, log out, or leave it for %d minutes", path.Base(fileName), int(timeout.Minutes())))
+}
+
+// watchWorkspace puts changed files back into v and closes those that
+// timed out, until done is closed. It closes stopped when it returns.
+func watchWorkspace(v *vault.Vault, ws *vault.Workspace, vaultPath string, done, stopped chan struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(workspacePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		updated, err := ws.Sync()
+		if err != nil {
+			showErrorNotification(err.Error())
+		}
+		expired, err := ws.Expire()
+		if err != nil {
+			showErrorNotification(err.Error())
+		}
+		if len(updated) == 0 && len(expired) == 0 {
+			continue
+		}
+
+		if err := saveWorkspaceChanges(v, vaultPath); err != nil {
+			showErrorNotification(err.Error())
+			continue
+		}
+		if len(updated) > 0 {
+			showSuccessNotification(fmt.Sprintf("Updated %s in the vault", strings.Join(updated, ", ")))
+		}
+		if len(expired) > 0 {
+			showSuccessNotification(fmt.Sprintf("Closed %s after it was left unchanged", strings.Join(expired, ", ")))
+		}
+	}
+}
+
+// closeWorkspace puts back any changes and wipes every file opened
+// temporarily. It is called on logout and when the app exits, before the
+// vault is closed, and waits for the watcher so that it does not save the
+// vault afterwards.
+func closeWorkspace() {
+	if workspace == nil {
+		return
+	}
+	close(workspaceDone)
+	<-workspaceStopped
+	err := workspace.Close()
+	vaultPath := workspaceVaultPath
+	workspace, workspaceDone, workspaceStopped, workspaceVaultPath = nil, nil, nil, ""
+
+	if saveErr := saveWorkspaceChanges(currentVault, vaultPath); err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		showErrorNotification(err.Error())
+	}
+}
+
+// saveWorkspaceChanges saves v after files were synced or closed. Nothing
+// is synced into a read-only vault, so it is left alone.
+func saveWorkspaceChanges(v *vault.Vault, vaultPath string) error {
+	if v.ReadOnly() {
+		return nil
+	}
+	return v.Save(vaultPath)
+}
+
+// showWorkspaceWindow lists the files opened temporarily and lets the user
+// close them, which puts back any changes and wipes them.
+func showWorkspaceWindow(vaultPath string) {
+	workspaceWindow := fyne.CurrentApp().NewWindow("Temporary Files")
+
+	var files []vault.OpenFile
+	var fileList *widget.List
+	reload := func() {
+		files = nil
+		if workspace != nil {
+			files = workspace.Files()
+		}
+		if fileList != nil {
+			fileList.Refresh()
+		}
+	}
+	reload()
+
+	fileList = widget.NewList(
+		func() int {
+			return len(files)
+		},
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil,
+				container.NewHBox(widget.NewButton("Open", nil), widget.NewButton("Close", nil)),
+				widget.NewLabel(""),
+			)
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			file := files[i]
+			row := o.(*fyne.Container)
+			label := row.Objects[0].(*widget.Label)
+			buttons := row.Objects[1].(*fyne.Container).Objects
+
+			label.SetText(fmt.Sprintf("%s  active %s", file.Name, formatTime(file.Active)))
+			buttons[0].(*widget.Button).OnTapped = func() {
+				openTemporarily(vaultPath, file.Name)
+				reload()
+			}
+			buttons[1].(*widget.Button).OnTapped = func() {
+				if workspace == nil {
+					return
+				}
+				err := workspace.CloseFile(file.Path)
+				if saveErr := saveWorkspaceChanges(currentVault, vaultPath); err == nil {
+					err = saveErr
+				}
+				if err != nil {
+					showErrorNotification(err.Error())
+				} else {
+					showSuccessNotification(fmt.Sprintf("%s closed and wiped", file.Name))
+				}
+				reload()
+			}
+		},
+	)
+
+	closeAllButton := widget.NewButton("Close All", func() {
+		closeWorkspace()
+		reload()
+	})
+
+	workspaceWindow.SetContent(container.NewBorder(nil, closeAllButton, nil, nil, fileList))
+	workspaceWindow.Resize(fyne.NewSize(550, 300))
+	workspaceWindow.CenterOnScreen()
+	workspaceWindow.Show()
+}
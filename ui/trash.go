@@ -0,0 +1,123 @@
+package ui
+
+import (
+	"fmt"
+	"secure-file-vault/vault"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// showTrashWindow lists removed files and lets the user restore them or
+// delete them for good. changed is called after anything is restored.
+func showTrashWindow(vaultPath string, changed func()) {
+	trashWindow := fyne.CurrentApp().NewWindow("Trash")
+
+	var entries []vault.TrashInfo
+	var trashList *widget.List
+	reload := func() {
+		list, err := currentVault.ListTrash(vaultKey)
+		if err != nil {
+			showErrorNotification(err.Error())
+			return
+		}
+		entries = list
+		if trashList != nil {
+			trashList.Refresh()
+		}
+	}
+	save := func(message string) {
+		if err := currentVault.Save(vaultPath); err != nil {
+			showErrorNotification(err.Error())
+		} else {
+			showSuccessNotification(message)
+		}
+		reload()
+		changed()
+	}
+	reload()
+
+	trashList = widget.NewList(
+		func() int {
+			return len(entries)
+		},
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil,
+				container.NewHBox(widget.NewButton("Restore", nil), widget.NewButton("Delete", nil)),
+				widget.NewLabel(""),
+			)
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			entry := entries[i]
+			row := o.(*fyne.Container)
+			label := row.Objects[0].(*widget.Label)
+			buttons := row.Objects[1].(*fyne.Container).Objects
+
+			label.SetText(fmt.Sprintf("%s  %s  deleted %s", entry.Name, formatSize(entry.Size), formatTime(entry.Deleted)))
+			buttons[0].(*widget.Button).OnTapped = func() {
+				if err := currentVault.RestoreFromTrash(entry.Index, vaultKey); err != nil {
+					showErrorNotification(err.Error())
+					return
+				}
+				save("File restored successfully")
+			}
+			buttons[1].(*widget.Button).OnTapped = func() {
+				dialog.ShowConfirm("Delete Forever",
+					fmt.Sprintf("Permanently delete %s? This cannot be undone.", entry.Name),
+					func(confirmed bool) {
+						if !confirmed {
+							return
+						}
+						if err := currentVault.PurgeTrash(entry.Index); err != nil {
+							showErrorNotification(err.Error())
+							return
+						}
+						save("File deleted permanently")
+					}, trashWindow)
+			}
+		},
+	)
+
+	emptyButton := widget.NewButton("Empty Trash", func() {
+		dialog.ShowConfirm("Empty Trash",
+			"Permanently delete everything in the trash? This cannot be undone.",
+			func(confirmed bool) {
+				if !confirmed {
+					return
+				}
+				if err := currentVault.EmptyTrash(); err != nil {
+					showErrorNotification(err.Error())
+					return
+				}
+				save("Trash emptied")
+			}, trashWindow)
+	})
+
+	trashWindow.SetContent(container.NewBorder(nil, emptyButton, nil, nil, trashList))
+	trashWindow.Resize(fyne.NewSize(600, 350))
+	trashWindow.CenterOnScreen()
+	trashWindow.Show()
+}
+
+// undoToastDuration is how long the undo toast stays up.
+const undoToastDuration = 8 * time.Second
+
+// showUndoToast briefly shows message at the bottom of window with a
+// button that calls undo.
+func showUndoToast(window fyne.Window, message string, undo func()) {
+	var toast *widget.PopUp
+	undoButton := widget.NewButton("Undo", func() {
+		toast.Hide()
+		undo()
+	})
+	toast = widget.NewPopUp(container.NewHBox(widget.NewLabel(message), undoButton), window.Canvas())
+
+	size := toast.MinSize()
+	canvasSize := window.Canvas().Size()
+	toast.ShowAtPosition(fyne.NewPos((canvasSize.Width-size.Width)/2, canvasSize.Height-size.Height-10))
+
+	time.AfterFunc(undoToastDuration, toast.Hide)
+}
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"os"
 	"secure-file-vault/db"
 	"secure-file-vault/vault"
 
@@ -31,6 +32,22 @@ func RunApp(dbPath string) {
 	if err := db.CreateUsersTable(dbConn); err != nil {
 		panic(fmt.Sprintf("Failed to create users table: %v", err))
 	}
+	if err := db.CreatePublicKeysTable(dbConn); err != nil {
+		panic(fmt.Sprintf("Failed to create public keys table: %v", err))
+	}
+	if err := db.CreateSharesTable(dbConn); err != nil {
+		panic(fmt.Sprintf("Failed to create shares table: %v", err))
+	}
+
+	// Files opened temporarily before a crash are still on disk.
+	if err := vault.WipeStaleWorkspaces(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to wipe temporary files: %v\n", err)
+	}
 
 	myApp.Run()
+
+	if currentVault != nil {
+		closeWorkspace()
+		currentVault.Close()
+	}
 }
@@ -3,7 +3,6 @@ package ui
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"secure-file-vault/vault"
 	"time"
 
@@ -11,7 +10,9 @@ import (
 	"fyne.io/fyne/v2/dialog"
 )
 
-func watchFileForChanges(filePath, vaultPath string, key []byte, vault *vault.Vault) {
+// watchFileForChanges offers to update the vault entry fileName when the
+// file extracted to filePath is modified.
+func watchFileForChanges(filePath, fileName, vaultPath string, key []byte, vault *vault.Vault) {
 	initialStat, err := os.Stat(filePath)
 	if err != nil {
 		fmt.Printf("Failed to get initial file stats: %v\n", err)
@@ -30,7 +31,7 @@ func watchFileForChanges(filePath, vaultPath string, key []byte, vault *vault.Va
 		if currentStat.ModTime().After(initialStat.ModTime()) {
 			showUpdateFileDialog(filePath, func(update bool) {
 				if update {
-					handleFileChange(filePath, vaultPath, key, vault)
+					handleFileChange(filePath, fileName, vaultPath, key, vault)
 				}
 			})
 			return
@@ -47,15 +48,15 @@ func showUpdateFileDialog(filePath string, callback func(bool)) {
 	)
 }
 
-func handleFileChange(filePath, vaultPath string, key []byte, vault *vault.Vault) {
-	data, err := os.ReadFile(filePath)
+func handleFileChange(filePath, fileName, vaultPath string, key []byte, vault *vault.Vault) {
+	file, err := os.Open(filePath)
 	if err != nil {
 		dialog.ShowError(err, fyne.CurrentApp().Driver().AllWindows()[0])
 		return
 	}
+	defer file.Close()
 
-	fileName := filepath.Base(filePath)
-	if err := vault.UpdateFile(fileName, key, data); err != nil {
+	if err := vault.UpdateFileFrom(fileName, key, file); err != nil {
 		dialog.ShowError(err, fyne.CurrentApp().Driver().AllWindows()[0])
 		return
 	}
@@ -0,0 +1,144 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// AgeExt is the extension of age files.
+const AgeExt = ".age"
+
+// AgeRecipients says who an age file is written for: X25519 recipients
+// such as "age1...", or a passphrase. age does not allow both at once.
+type AgeRecipients struct {
+	Recipients []string
+	Passphrase string
+}
+
+func (recipients AgeRecipients) parse() ([]age.Recipient, error) {
+	switch {
+	case recipients.Passphrase != "" && len(recipients.Recipients) > 0:
+		return nil, fmt.Errorf("an age file is encrypted with a passphrase or to recipients, not both")
+	case recipients.Passphrase != "":
+		recipient, err := age.NewScryptRecipient(recipients.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{recipient}, nil
+	case len(recipients.Recipients) == 0:
+		return nil, fmt.Errorf("no age recipients")
+	}
+
+	parsed, err := age.ParseRecipients(strings.NewReader(strings.Join(recipients.Recipients, "\n")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient: %v", err)
+	}
+	return parsed, nil
+}
+
+// AgeIdentities says how to open an age file: with X25519 identities, as
+// "AGE-SECRET-KEY-1..." lines or the contents of an identity file, or with
+// a passphrase.
+type AgeIdentities struct {
+	Identities []string
+	Passphrase string
+}
+
+func (identities AgeIdentities) parse() ([]age.Identity, error) {
+	var parsed []age.Identity
+	if len(identities.Identities) > 0 {
+		ids, err := age.ParseIdentities(strings.NewReader(strings.Join(identities.Identities, "\n")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age identity: %v", err)
+		}
+		parsed = append(parsed, ids...)
+	}
+	if identities.Passphrase != "" {
+		identity, err := age.NewScryptIdentity(identities.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, identity)
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("no age identities")
+	}
+	return parsed, nil
+}
+
+// ExtractFileAgeTo writes the entry named filePath to w as an age file for
+// recipients, so that it is never written out in plaintext.
+func (vault *Vault) ExtractFileAgeTo(filePath string, key []byte, recipients AgeRecipients, w io.Writer) error {
+	parsed, err := recipients.parse()
+	if err != nil {
+		return err
+	}
+
+	aw, err := age.Encrypt(w, parsed...)
+	if err != nil {
+		return fmt.Errorf("failed to start age file: %v", err)
+	}
+	if err := vault.ExtractFileTo(filePath, key, aw); err != nil {
+		return err
+	}
+	return aw.Close()
+}
+
+// ExtractFileAge is ExtractFileAgeTo writing to a file at outputPath,
+// which is removed again if the entry cannot be extracted.
+func (vault *Vault) ExtractFileAge(filePath string, key []byte, recipients AgeRecipients, outputPath string) error {
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+
+	err = vault.ExtractFileAgeTo(filePath, key, recipients, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+	return nil
+}
+
+// AddAgeFile decrypts the age file read from r with identities and adds
+// its content as filePath. Armored age files are accepted too. Nothing is
+// added unless the whole file decrypts and authenticates.
+func (vault *Vault) AddAgeFile(filePath string, r io.Reader, meta Metadata, identities AgeIdentities, key []byte) error {
+	parsed, err := identities.parse()
+	if err != nil {
+		return err
+	}
+
+	// Armored files may start with whitespace.
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	start, _ := br.Peek(512)
+	if bytes.HasPrefix(bytes.TrimLeft(start, " \t\r\n"), []byte(armor.Header)) {
+		src = armor.NewReader(br)
+	}
+
+	plaintext, err := age.Decrypt(src, parsed...)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt age file: %v", err)
+	}
+	return vault.AddFileWithMetadata(filePath, plaintext, meta, key)
+}
+
+// AgeFileName is the name an age file is added under: its own name without
+// the .age extension.
+func AgeFileName(name string) string {
+	if trimmed := strings.TrimSuffix(name, AgeExt); trimmed != "" {
+		return trimmed
+	}
+	return name
+}
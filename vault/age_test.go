@@ -0,0 +1,154 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// ageVector is one of the test vectors in testdata/age/vectors.
+type ageVector struct {
+	expect     string
+	payload    string
+	identities AgeIdentities
+	file       []byte
+}
+
+func readAgeVector(t *testing.T, filePath string) ageVector {
+	t.Helper()
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, file, ok := bytes.Cut(data, []byte("\n\n"))
+	if !ok {
+		t.Fatalf("%s: no empty line after the header", filePath)
+	}
+	vector := ageVector{file: file}
+	for _, line := range strings.Split(string(header), "\n") {
+		name, value, _ := strings.Cut(line, ": ")
+		switch name {
+		case "expect":
+			vector.expect = value
+		case "payload":
+			vector.payload = value
+		case "identity":
+			vector.identities.Identities = append(vector.identities.Identities, value)
+		case "passphrase":
+			vector.identities.Passphrase = value
+		}
+	}
+	return vector
+}
+
+func TestAddAgeFileVectors(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	paths, err := filepath.Glob(filepath.Join("testdata", "age", "vectors", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, vectorPath := range paths {
+		name := filepath.Base(vectorPath)
+		vector := readAgeVector(t, vectorPath)
+
+		err := vault.AddAgeFile(name, bytes.NewReader(vector.file), Metadata{}, vector.identities, key)
+		if vector.expect != "success" {
+			if err == nil {
+				t.Errorf("%s: added, want %s", name, vector.expect)
+			}
+			if _, err := vault.Metadata(name, key); err == nil {
+				t.Errorf("%s: entry added although the file is bad", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := vault.ExtractFileTo(name, key, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if sum := sha256.Sum256(buf.Bytes()); hex.EncodeToString(sum[:]) != vector.payload {
+			t.Errorf("%s: payload does not match its hash", name)
+		}
+	}
+	if len(paths) < 100 {
+		t.Fatalf("only %d vectors found", len(paths))
+	}
+}
+
+func TestAgeRoundTrip(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	if err := vault.AddFile("secret.txt", []byte("secret"), key); err != nil {
+		t.Fatal(err)
+	}
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name       string
+		recipients AgeRecipients
+		identities AgeIdentities
+		wrong      AgeIdentities
+	}{
+		{
+			"x25519",
+			AgeRecipients{Recipients: []string{"# a comment", identity.Recipient().String()}},
+			AgeIdentities{Identities: []string{identity.String()}},
+			AgeIdentities{Identities: []string{other.String()}},
+		},
+		{
+			"passphrase",
+			AgeRecipients{Passphrase: "correct horse"},
+			AgeIdentities{Passphrase: "correct horse"},
+			AgeIdentities{Passphrase: "wrong horse"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := vault.ExtractFileAgeTo("secret.txt", key, test.recipients, &buf); err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(buf.Bytes(), []byte("secret")) {
+				t.Fatal("the age file holds the plaintext")
+			}
+
+			if err := vault.AddAgeFile("wrong.txt", bytes.NewReader(buf.Bytes()), Metadata{}, test.wrong, key); err == nil {
+				t.Error("opened with the wrong identity")
+			}
+			back := test.name + ".txt"
+			if err := vault.AddAgeFile(back, bytes.NewReader(buf.Bytes()), Metadata{}, test.identities, key); err != nil {
+				t.Fatal(err)
+			}
+			if data, err := readEntry(vault, back, key); err != nil || data != "secret" {
+				t.Errorf("round trip gave %q, %v", data, err)
+			}
+		})
+	}
+
+	if err := vault.ExtractFileAgeTo("secret.txt", key, AgeRecipients{Recipients: []string{"age1nope"}}, &bytes.Buffer{}); err == nil {
+		t.Error("encrypted to an invalid recipient")
+	}
+	outputPath := filepath.Join(t.TempDir(), "missing.age")
+	if err := vault.ExtractFileAge("missing.txt", key, AgeRecipients{Passphrase: "pass"}, outputPath); err == nil {
+		t.Error("extracted an entry that does not exist")
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Error("output file left behind")
+	}
+}
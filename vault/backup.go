@@ -0,0 +1,168 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// BackupCount is how many earlier versions of the vault file Save keeps,
+// as vaultPath.bak.1 (the newest) to vaultPath.bak.BackupCount.
+const BackupCount = 3
+
+var ErrVaultCorrupted = errors.New("vault file is corrupted")
+
+func backupPath(vaultPath string, n int) string {
+	return fmt.Sprintf("%s.bak.%d", vaultPath, n)
+}
+
+// writeVaultFile replaces vaultPath with the encoded vault without ever
+// truncating the existing file: the vault is written and synced to a
+// temporary file, the current file becomes the newest backup, and the
+// temporary file is renamed over it.
+func (vault *Vault) writeVaultFile(vaultPath string) error {
+	dir := filepath.Dir(vaultPath)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(vaultPath)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := vault.encode(tmp); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := rotateBackups(vaultPath); err != nil {
+		return fmt.Errorf("failed to rotate backups: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), vaultPath); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// rotateBackups shifts the existing backups up by one and links the
+// current vault file in as the newest. A current file that does not decode
+// is left out, so backups only ever hold good versions.
+func rotateBackups(vaultPath string) error {
+	if _, err := readVaultFile(vaultPath); err != nil {
+		return nil
+	}
+
+	os.Remove(backupPath(vaultPath, BackupCount))
+	for n := BackupCount - 1; n >= 1; n-- {
+		err := os.Rename(backupPath(vaultPath, n), backupPath(vaultPath, n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Link(vaultPath, backupPath(vaultPath, 1)); err != nil {
+		return copyFile(vaultPath, backupPath(vaultPath, 1))
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir makes a rename in dir durable. Windows cannot sync directories
+// and does not need to.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func readVaultFile(path string) (*Vault, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	vault, err := decodeVault(file)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedVersion) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrVaultCorrupted, err)
+	}
+	return vault, nil
+}
+
+// OpenBackup opens the newest backup of vaultPath that decodes and unlocks
+// with password. It returns the backup's path alongside the vault, which
+// saves back to vaultPath.
+func OpenBackup(vaultPath, password string) (*Vault, []byte, string, error) {
+	lock, err := lockVault(vaultPath)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var lastErr error = os.ErrNotExist
+	for n := 1; n <= BackupCount; n++ {
+		path := backupPath(vaultPath, n)
+		vault, key, err := openVaultFile(path, vaultPath, password, false)
+		if err == nil {
+			vault.lock = lock
+			return vault, key, path, nil
+		}
+		if !os.IsNotExist(err) {
+			lastErr = err
+		}
+	}
+
+	lock.release()
+	return nil, nil, "", fmt.Errorf("no usable backup: %v", lastErr)
+}
+
+// backupBlobs returns the blobs referenced by any backup of vaultPath.
+func backupBlobs(vaultPath string) map[string]bool {
+	blobs := make(map[string]bool)
+	for n := 1; n <= BackupCount; n++ {
+		backup, err := readVaultFile(backupPath(vaultPath, n))
+		if err != nil {
+			continue
+		}
+		backup.referencedBlobs(blobs)
+	}
+	return blobs
+}
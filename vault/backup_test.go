@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSaveRotatesBackups(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+
+	for i := 1; i <= BackupCount+2; i++ {
+		if err := vault.AddFile(fmt.Sprintf("%d.txt", i), []byte("data"), key); err != nil {
+			t.Fatal(err)
+		}
+		if err := vault.Save(vaultPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The newest backup is the save before the last one.
+	for n := 1; n <= BackupCount; n++ {
+		backup, err := readVaultFile(backupPath(vaultPath, n))
+		if err != nil {
+			t.Fatalf("backup %d: %v", n, err)
+		}
+		if want := BackupCount + 2 - n; len(backup.Files) != want {
+			t.Errorf("backup %d has %d entries, want %d", n, len(backup.Files), want)
+		}
+	}
+	if _, err := os.Stat(backupPath(vaultPath, BackupCount+1)); !os.IsNotExist(err) {
+		t.Errorf("more than %d backups kept", BackupCount)
+	}
+}
+
+func TestSaveIsAtomic(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+
+	// Whatever a reader sees while saves are going on must decode.
+	var stop atomic.Bool
+	var bad atomic.Int32
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for !stop.Load() {
+			if _, err := readVaultFile(vaultPath); err != nil {
+				bad.Add(1)
+			}
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		if err := vault.AddFile(fmt.Sprintf("%d.txt", i), []byte("data"), key); err != nil {
+			t.Fatal(err)
+		}
+		if err := vault.Save(vaultPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	if n := bad.Load(); n > 0 {
+		t.Errorf("vault file failed to decode %d times during saves", n)
+	}
+	temps, err := filepath.Glob(filepath.Join(filepath.Dir(vaultPath), ".*.tmp-*"))
+	if err != nil || len(temps) > 0 {
+		t.Errorf("temporary files left behind: %v", temps)
+	}
+}
+
+func TestOpenBackupAfterCorruption(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+
+	if err := vault.AddFile("a.txt", []byte("kept"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.AddFile("b.txt", []byte("lost"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+
+	if err := os.WriteFile(vaultPath, []byte("not a vault"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenVault(vaultPath, testPassword); !errors.Is(err, ErrVaultCorrupted) {
+		t.Fatalf("OpenVault returned %v, want ErrVaultCorrupted", err)
+	}
+
+	restored, key, path, err := OpenBackup(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if path != backupPath(vaultPath, 1) {
+		t.Errorf("opened %s, want the newest backup", path)
+	}
+	if data, err := readEntry(restored, "a.txt", key); err != nil || data != "kept" {
+		t.Fatalf("entry from backup: %q, %v", data, err)
+	}
+	if _, err := readEntry(restored, "b.txt", key); err == nil {
+		t.Error("backup has an entry added after it was taken")
+	}
+
+	// Saving the backup replaces the corrupted file, which does not become
+	// a backup itself.
+	if err := restored.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{vaultPath, backupPath(vaultPath, 1)} {
+		if _, err := readVaultFile(path); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
+
+func TestOpenBackupWithoutBackups(t *testing.T) {
+	vault, _, vaultPath := newTestVault(t)
+	vault.Close()
+
+	for n := 1; n <= BackupCount; n++ {
+		os.Remove(backupPath(vaultPath, n))
+	}
+	if _, _, _, err := OpenBackup(vaultPath, testPassword); err == nil {
+		t.Fatal("OpenBackup succeeded without backups")
+	}
+}
@@ -0,0 +1,318 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// File bodies are stored outside the vault file, which only holds the
+// index, as encrypted blobs in a directory next to it. A blob is named
+// after a keyed hash of its plaintext, so identical files are stored once
+// without the names revealing to anyone without the key which files are
+// the same. A blob is deleted once no entry, version or backup refers to
+// it any more.
+func (vault *Vault) blobDir() string {
+	return vault.path + ".blobs"
+}
+
+func (vault *Vault) blobPath(blob string) string {
+	return filepath.Join(vault.blobDir(), blob)
+}
+
+// contentAD is the associated data every blob is sealed with. Blobs are
+// tied to entries by the content ID in the entry's sealed metadata.
+var contentAD = []byte("secure-file-vault content")
+
+// newContentMAC returns the keyed hash that names blobs, an HMAC-SHA256
+// under a key derived from the master key. A compressed body's codec is
+// hashed first, so the same content stored with different codecs gets
+// different blobs.
+func newContentMAC(key []byte, codec string) (hash.Hash, error) {
+	macKey := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, key, nil, []byte("secure-file-vault content id"))
+	if _, err := io.ReadFull(kdf, macKey); err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, macKey)
+	if codec != CodecNone {
+		mac.Write([]byte(codec + "\x00"))
+	}
+	return mac, nil
+}
+
+// pendingBlob is a body that has been encrypted into a temporary file but
+// not yet stored under its content ID.
+type pendingBlob struct {
+	tmp   string
+	id    string
+	codec string
+	size  int64
+}
+
+// encryptBlob compresses with codec and encrypts everything read from r
+// into a temporary file in the blob directory. The result must be passed
+// to storeBlob or discarded.
+func (vault *Vault) encryptBlob(key []byte, codec string, r io.Reader) (*pendingBlob, error) {
+	if err := os.MkdirAll(vault.blobDir(), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %v", err)
+	}
+
+	mac, err := newContentMAC(key, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(vault.blobDir(), ".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	blob := &pendingBlob{tmp: tmp.Name(), codec: codec}
+
+	err = func() error {
+		defer tmp.Close()
+
+		sw, err := NewStreamWriter(tmp, key, contentAD)
+		if err != nil {
+			return err
+		}
+		cw, err := compressWriter(sw, codec)
+		if err != nil {
+			return err
+		}
+		blob.size, err = io.Copy(cw, io.TeeReader(r, mac))
+		if err != nil {
+			return err
+		}
+		if err := cw.Close(); err != nil {
+			return err
+		}
+		if err := sw.Close(); err != nil {
+			return err
+		}
+		if err := tmp.Sync(); err != nil {
+			return err
+		}
+		return tmp.Close()
+	}()
+	if err != nil {
+		blob.discard()
+		return nil, err
+	}
+
+	blob.id = hex.EncodeToString(mac.Sum(nil))
+	return blob, nil
+}
+
+// storeBlob moves a pending blob into place, or discards it if the same
+// content is already stored. The caller must hold vault.mu and add the
+// entry referring to the blob before releasing it, so that Save cannot
+// delete the blob in between.
+func (vault *Vault) storeBlob(blob *pendingBlob) error {
+	if _, err := os.Stat(vault.blobPath(blob.id)); err == nil {
+		blob.discard()
+		return nil
+	}
+	if err := os.Rename(blob.tmp, vault.blobPath(blob.id)); err != nil {
+		blob.discard()
+		return fmt.Errorf("failed to store blob: %v", err)
+	}
+	return nil
+}
+
+func (blob *pendingBlob) discard() {
+	os.Remove(blob.tmp)
+}
+
+// copyContent decrypts one body of file, its current one or a version,
+// into w, decompressing it if it was compressed. The plaintext is checked
+// against the content ID once it has all been written, and the content ID
+// against the entry's metadata, so a body cannot be swapped for another
+// entry's.
+func (vault *Vault) copyContent(key []byte, file FileEntry, content Version, fileName string, w io.Writer) error {
+	meta, err := vault.cache.metadata(key, file.Index, file.Name, content.Meta)
+	if err != nil {
+		return err
+	}
+	if meta.Content != content.Blob {
+		return fmt.Errorf("file integrity check failed for %s", fileName)
+	}
+
+	blobFile, err := os.Open(vault.blobPath(content.Blob))
+	if err != nil {
+		return fmt.Errorf("failed to open blob: %v", err)
+	}
+	defer blobFile.Close()
+
+	sr, err := NewStreamReader(blobFile, key, contentAD)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt data: %v", err)
+	}
+	r, err := decompressReader(sr, meta.Codec)
+	if err != nil {
+		return fmt.Errorf("failed to decompress data: %v", err)
+	}
+
+	mac, err := newContentMAC(key, meta.Codec)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.MultiWriter(w, mac), r); err != nil {
+		return fmt.Errorf("failed to decrypt data: %v", err)
+	}
+
+	// Verify file integrity
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(content.Blob)) {
+		return fmt.Errorf("file integrity check failed for %s", fileName)
+	}
+	return nil
+}
+
+// referencedBlobs adds every blob the vault's entries, including those in
+// the trash and in quarantine, refer to.
+func (vault *Vault) referencedBlobs(blobs map[string]bool) {
+	for _, file := range vault.Files {
+		for _, blob := range file.blobs() {
+			blobs[blob] = true
+		}
+	}
+	for _, entry := range vault.Trash {
+		for _, blob := range entry.blobs() {
+			blobs[blob] = true
+		}
+	}
+	for _, entry := range vault.Quarantine {
+		for _, blob := range entry.blobs() {
+			blobs[blob] = true
+		}
+	}
+}
+
+// removeBlobs deletes the blobs entries have stopped referencing, unless a
+// backup of vaultPath still needs them. Those stay listed in
+// UnreferencedBlobs until they age out of the backups.
+func (vault *Vault) removeBlobs(vaultPath string) {
+	if len(vault.UnreferencedBlobs) == 0 {
+		return
+	}
+
+	referenced := backupBlobs(vaultPath)
+	vault.referencedBlobs(referenced)
+
+	// Blobs are shared, so the same one can be listed more than once.
+	var kept []string
+	seen := make(map[string]bool)
+	for _, blob := range vault.UnreferencedBlobs {
+		if seen[blob] {
+			continue
+		}
+		seen[blob] = true
+
+		if referenced[blob] {
+			kept = append(kept, blob)
+			continue
+		}
+		os.Remove(vault.blobPath(blob))
+	}
+	vault.UnreferencedBlobs = kept
+}
+
+// upgradeBlobs moves every body into a content-addressed blob: those kept
+// inline by vaults written before the blob store, and those in blobs
+// sealed to their entry by vaults written before deduplication.
+func (vault *Vault) upgradeBlobs(key []byte) error {
+	for i := range vault.Files {
+		if err := vault.upgradeEntry(key, &vault.Files[i]); err != nil {
+			return err
+		}
+	}
+	for i := range vault.Trash {
+		if err := vault.upgradeEntry(key, &vault.Trash[i].FileEntry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (vault *Vault) upgradeEntry(key []byte, file *FileEntry) error {
+	for n, version := range file.Versions {
+		upgraded, err := vault.upgradeContent(key, file, version)
+		if err != nil {
+			return err
+		}
+		file.Versions[n] = upgraded
+	}
+
+	upgraded, err := vault.upgradeContent(key, file, file.current())
+	if err != nil {
+		return err
+	}
+	file.Blob, file.Hash, file.Meta = upgraded.Blob, upgraded.Hash, upgraded.Meta
+	file.Data = nil
+	return nil
+}
+
+func (vault *Vault) upgradeContent(key []byte, file *FileEntry, content Version) (Version, error) {
+	var r io.Reader
+	if content.Blob == "" {
+		data, err := DecryptData(key, file.Data, entryAD(file.Index, file.Name))
+		if err != nil {
+			return Version{}, fmt.Errorf("failed to decrypt data: %v", err)
+		}
+		r = bytes.NewReader(data)
+	} else {
+		blobFile, err := os.Open(vault.blobPath(content.Blob))
+		if err != nil {
+			return Version{}, fmt.Errorf("failed to open blob: %v", err)
+		}
+		defer blobFile.Close()
+
+		r, err = NewStreamReader(blobFile, key, entryAD(file.Index, file.Name))
+		if err != nil {
+			return Version{}, fmt.Errorf("failed to decrypt data: %v", err)
+		}
+	}
+
+	hasher := sha256.New()
+	blob, err := vault.encryptBlob(key, CodecNone, io.TeeReader(r, hasher))
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to encrypt data: %v", err)
+	}
+	if base64.StdEncoding.EncodeToString(hasher.Sum(nil)) != content.Hash {
+		blob.discard()
+		return Version{}, fmt.Errorf("file integrity check failed for entry %d", file.Index)
+	}
+
+	meta, err := openLegacyMetadata(key, file.Index, content.Meta)
+	if err != nil {
+		blob.discard()
+		return Version{}, err
+	}
+	if meta.Size == 0 {
+		meta.Size = blob.size
+	}
+	meta.Content = blob.id
+	sealed, err := sealMetadata(key, file.Index, file.Name, meta)
+	if err != nil {
+		blob.discard()
+		return Version{}, fmt.Errorf("failed to encrypt metadata: %v", err)
+	}
+
+	if err := vault.storeBlob(blob); err != nil {
+		return Version{}, err
+	}
+	if content.Blob != "" {
+		vault.UnreferencedBlobs = append(vault.UnreferencedBlobs, content.Blob)
+	}
+	return Version{Blob: blob.id, Hash: blob.id, Meta: sealed}, nil
+}
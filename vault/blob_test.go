@@ -0,0 +1,59 @@
+package vault
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRemovedBlobKeptWhileBackupsReferToIt(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+
+	if err := vault.AddFile("a.txt", []byte("first"), key); err != nil {
+		t.Fatal(err)
+	}
+	blobs := vault.Files[0].blobs()
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vault.RemoveFile("a.txt", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.EmptyTrash(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The vault file saved above, which still has the entry, becomes a
+	// backup on each of the next BackupCount saves.
+	for n := 1; n <= BackupCount; n++ {
+		if err := vault.Save(vaultPath); err != nil {
+			t.Fatal(err)
+		}
+		for _, blob := range blobs {
+			if _, err := os.Stat(vault.blobPath(blob)); err != nil {
+				t.Fatalf("blob needed by backup %d was deleted: %v", n, err)
+			}
+		}
+	}
+
+	backup, key, err := openVaultFile(backupPath(vaultPath, BackupCount), vaultPath, testPassword, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readEntry(backup, "a.txt", key); err != nil || data != "first" {
+		t.Fatalf("extracting from the oldest backup: %q, %v", data, err)
+	}
+
+	// Once no backup has the entry, its blob goes.
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, blob := range blobs {
+		if _, err := os.Stat(vault.blobPath(blob)); !os.IsNotExist(err) {
+			t.Errorf("unreferenced blob was kept: %v", err)
+		}
+	}
+	if len(vault.UnreferencedBlobs) != 0 {
+		t.Errorf("UnreferencedBlobs = %v, want none", vault.UnreferencedBlobs)
+	}
+}
@@ -0,0 +1,371 @@
+package vault
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// A bundle carries entries from one vault to another. It starts with
+// bundleMagic and a big-endian uint16 version, followed by the
+// gob-encoded bundleHeader and then a stream encrypted under a key derived
+// from the bundle's passphrase. The stream holds a tar archive with one
+// regular file per entry; an entry's note is kept as a PAX record.
+var bundleMagic = []byte("SFBUNDLE")
+
+const bundleVersion = 1
+
+// bundleAD is the associated data of a bundle's stream.
+var bundleAD = []byte("secure-file-vault bundle")
+
+// bundleNoteRecord is the PAX record holding an entry's note.
+const bundleNoteRecord = "SFV.note"
+
+var ErrNotBundle = errors.New("not a vault bundle")
+
+type bundleHeader struct {
+	KDF KDFParams
+}
+
+// ImportOptions controls where ImportBundle puts entries and what it does
+// with names that are already taken.
+type ImportOptions struct {
+	// Dest is the vault folder entries are imported into. Empty is the
+	// vault root.
+	Dest   string
+	Policy ConflictPolicy
+}
+
+// ImportResult reports what ImportBundle did with one entry of a bundle.
+// Path is the name it was stored under, and Action is one of the Extract
+// actions.
+type ImportResult struct {
+	Name   string
+	Path   string
+	Action string
+	Err    error
+}
+
+// bundleItem is an entry on its way into a bundle.
+type bundleItem struct {
+	name string
+	path string
+	file FileEntry
+}
+
+// ExportBundle writes the named entries and folders to w as a bundle that
+// can only be opened with passphrase, which has nothing to do with the
+// vault's own password. Files are stored under their base name and folders
+// with their structure, as ExtractFiles and ExtractTree would write them.
+// With no names the whole vault is exported. It returns the names the
+// entries have in the bundle.
+func (vault *Vault) ExportBundle(names []string, passphrase string, key []byte, w io.Writer) ([]string, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("the bundle passphrase is empty")
+	}
+
+	items, err := vault.bundleItems(names, key)
+	if err != nil {
+		return nil, err
+	}
+
+	kdf, err := NewKDFParams()
+	if err != nil {
+		return nil, err
+	}
+	bundleKey, err := DeriveKey(passphrase, kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	var version [2]byte
+	binary.BigEndian.PutUint16(version[:], bundleVersion)
+	if _, err := w.Write(append(append([]byte{}, bundleMagic...), version[:]...)); err != nil {
+		return nil, err
+	}
+	if err := gob.NewEncoder(w).Encode(bundleHeader{KDF: kdf}); err != nil {
+		return nil, err
+	}
+
+	return vault.writeEntryStream(w, bundleKey, bundleAD, items, key)
+}
+
+// writeEntryStream writes items to w as a tar archive encrypted under
+// streamKey. Bundles and shares carry their entries this way.
+func (vault *Vault) writeEntryStream(w io.Writer, streamKey, ad []byte, items []bundleItem, key []byte) ([]string, error) {
+	sw, err := NewStreamWriter(w, streamKey, ad)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(sw)
+
+	written := make([]string, 0, len(items))
+	for _, item := range items {
+		if err := vault.writeBundleEntry(tw, item, key); err != nil {
+			return nil, fmt.Errorf("failed to export %s: %v", item.path, err)
+		}
+		written = append(written, item.name)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := sw.Close(); err != nil {
+		return nil, err
+	}
+	return written, nil
+}
+
+// bundleItems resolves names to the entries to export, sorted by their
+// names in the bundle.
+func (vault *Vault) bundleItems(names []string, key []byte) ([]bundleItem, error) {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+
+	_, dirs, err := vault.paths(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, name := range names {
+		name, err := cleanPath(name)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, name)
+	}
+
+	items := make(map[string]bundleItem)
+	for _, file := range vault.Files {
+		filePath, err := vault.decryptName(key, file.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt filename: %v", err)
+		}
+
+		bundleName := ""
+		if len(selected) == 0 {
+			bundleName = filePath
+		}
+		for _, name := range selected {
+			switch {
+			case filePath == name:
+				bundleName = path.Base(filePath)
+			case dirs[name] && isUnder(filePath, name):
+				bundleName = strings.TrimPrefix(filePath, parentDirPrefix(name))
+			default:
+				continue
+			}
+			break
+		}
+		if bundleName == "" {
+			continue
+		}
+
+		if other, ok := items[bundleName]; ok {
+			return nil, fmt.Errorf("both %s and %s would be exported as %s", other.path, filePath, bundleName)
+		}
+		items[bundleName] = bundleItem{name: bundleName, path: filePath, file: file}
+	}
+
+	for _, name := range selected {
+		found := dirs[name]
+		for _, item := range items {
+			found = found || item.path == name
+		}
+		if !found {
+			return nil, fmt.Errorf("file not found: %s", name)
+		}
+	}
+
+	sorted := make([]bundleItem, 0, len(items))
+	for _, item := range items {
+		sorted = append(sorted, item)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+	return sorted, nil
+}
+
+// parentDirPrefix is what is cut off the paths in dir so that dir itself
+// becomes the top of the exported tree.
+func parentDirPrefix(dir string) string {
+	if parent := path.Dir(dir); parent != "." {
+		return parent + "/"
+	}
+	return ""
+}
+
+func (vault *Vault) writeBundleEntry(tw *tar.Writer, item bundleItem, key []byte) error {
+	meta, err := vault.fileMetadata(key, item.file)
+	if err != nil {
+		return err
+	}
+
+	mode := int64(0644)
+	if meta.Mode != 0 {
+		mode = int64(meta.Mode.Perm())
+	}
+	modTime := meta.ModTime
+	if modTime.IsZero() {
+		modTime = meta.Updated
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     item.name,
+		Mode:     mode,
+		Size:     meta.Size,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	}
+	if meta.Note != "" {
+		header.PAXRecords = map[string]string{bundleNoteRecord: meta.Note}
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	return vault.copyContent(key, item.file, item.file.current(), item.path, tw)
+}
+
+// ImportBundle adds the entries of a bundle written by ExportBundle,
+// decrypting it with passphrase. Entries whose name is taken are handled
+// as opts.Policy says; overwriting one updates it, so its old content is
+// kept as a version.
+//
+// An entry that cannot be added does not stop the others. The error is set
+// if the bundle could not be read, in which case the results cover the
+// entries read before that.
+func (vault *Vault) ImportBundle(r io.Reader, passphrase string, key []byte, opts ImportOptions) ([]ImportResult, error) {
+	if vault.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(bundleMagic)+2)
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic[:len(bundleMagic)], bundleMagic) {
+		return nil, ErrNotBundle
+	}
+	if v := binary.BigEndian.Uint16(magic[len(bundleMagic):]); v != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", v)
+	}
+
+	var header bundleHeader
+	if err := gob.NewDecoder(br).Decode(&header); err != nil {
+		return nil, fmt.Errorf("failed to read bundle header: %v", err)
+	}
+	kdf := header.KDF
+	if kdf.Algorithm != KDFArgon2id {
+		return nil, fmt.Errorf("unsupported bundle key derivation")
+	}
+	bundleKey, err := DeriveKey(passphrase, kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := vault.readEntryStream(br, bundleKey, bundleAD, key, opts)
+	if err == errWrongStreamKey {
+		return nil, fmt.Errorf("invalid passphrase or damaged bundle")
+	}
+	return results, err
+}
+
+// errWrongStreamKey is returned by readEntryStream if not even the first
+// entry could be decrypted.
+var errWrongStreamKey = errors.New("wrong key")
+
+// readEntryStream adds the entries of a stream written by
+// writeEntryStream to the vault.
+func (vault *Vault) readEntryStream(r io.Reader, streamKey, ad, key []byte, opts ImportOptions) ([]ImportResult, error) {
+	sr, err := NewStreamReader(r, streamKey, ad)
+	if err != nil {
+		return nil, errWrongStreamKey
+	}
+
+	var results []ImportResult
+	tr := tar.NewReader(sr)
+	for {
+		entry, err := tr.Next()
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			if len(results) == 0 {
+				return nil, errWrongStreamKey
+			}
+			return results, fmt.Errorf("failed to read entries: %v", err)
+		}
+		if entry.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		result := ImportResult{Name: entry.Name}
+		result.Path, result.Action, result.Err = vault.importEntry(entry, tr, key, opts)
+		results = append(results, result)
+	}
+}
+
+func (vault *Vault) importEntry(entry *tar.Header, r io.Reader, key []byte, opts ImportOptions) (string, string, error) {
+	filePath, err := cleanPath(path.Join(opts.Dest, entry.Name))
+	if err != nil {
+		return entry.Name, ExtractFailed, err
+	}
+
+	vault.mu.RLock()
+	files, dirs, err := vault.paths(key)
+	vault.mu.RUnlock()
+	if err != nil {
+		return filePath, ExtractFailed, err
+	}
+
+	action := ExtractCreated
+	if files[filePath] || dirs[filePath] {
+		switch {
+		case opts.Policy == ConflictSkip:
+			return filePath, ExtractSkipped, nil
+		case opts.Policy == ConflictRename:
+			filePath = freeName(filePath, files, dirs)
+			action = ExtractRenamed
+		case dirs[filePath]:
+			return filePath, ExtractFailed, fmt.Errorf("%s is a folder", filePath)
+		default:
+			if err := vault.UpdateFileFrom(filePath, key, r); err != nil {
+				return filePath, ExtractFailed, err
+			}
+			return filePath, ExtractOverwritten, nil
+		}
+	}
+
+	meta := Metadata{
+		Mode:    os.FileMode(entry.Mode).Perm(),
+		ModTime: entry.ModTime,
+		Note:    entry.PAXRecords[bundleNoteRecord],
+	}
+	if err := vault.AddFileWithMetadata(filePath, r, meta, key); err != nil {
+		return filePath, ExtractFailed, err
+	}
+	return filePath, action, nil
+}
+
+// freeName returns the first of "name (1).ext", "name (2).ext", ... that
+// is not taken in the vault.
+func freeName(filePath string, files, dirs map[string]bool) string {
+	ext := path.Ext(filePath)
+	base := strings.TrimSuffix(filePath, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !files[candidate] && !dirs[candidate] {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	src, srcKey, _ := newTestVault(t)
+	meta := Metadata{Mode: 0640, Note: "the top one"}
+	if err := src.AddFileWithMetadata("top.txt", bytes.NewReader([]byte("top")), meta, srcKey); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"docs/a.txt", "docs/sub/b.txt", "other/a.txt"} {
+		if err := src.AddFile(name, []byte(name), srcKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := src.ExportBundle([]string{"docs/a.txt", "other/a.txt"}, "passphrase", srcKey, &bytes.Buffer{}); err == nil {
+		t.Error("exported two entries under the same name")
+	}
+	if _, err := src.ExportBundle([]string{"nope"}, "passphrase", srcKey, &bytes.Buffer{}); err == nil {
+		t.Error("exported an entry that does not exist")
+	}
+
+	var bundle bytes.Buffer
+	names, err := src.ExportBundle([]string{"docs", "top.txt"}, "passphrase", srcKey, &bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(names)
+	if want := []string{"docs/a.txt", "docs/sub/b.txt", "top.txt"}; !slices.Equal(names, want) {
+		t.Fatalf("exported %v, want %v", names, want)
+	}
+
+	dst, dstKey, _ := newTestVault(t)
+	if _, err := dst.ImportBundle(bytes.NewReader(bundle.Bytes()), "wrong", dstKey, ImportOptions{}); err == nil {
+		t.Error("imported with the wrong passphrase")
+	}
+	if _, err := dst.ImportBundle(bytes.NewReader([]byte("not a bundle at all")), "passphrase", dstKey, ImportOptions{}); !errors.Is(err, ErrNotBundle) {
+		t.Errorf("importing garbage returned %v, want ErrNotBundle", err)
+	}
+	tampered := bytes.Clone(bundle.Bytes())
+	tampered[len(tampered)-20] ^= 1
+	if _, err := dst.ImportBundle(bytes.NewReader(tampered), "passphrase", dstKey, ImportOptions{}); err == nil {
+		t.Error("imported a tampered bundle")
+	}
+
+	dst, dstKey, _ = newTestVault(t)
+	if err := dst.AddFile("in/top.txt", []byte("already here"), dstKey); err != nil {
+		t.Fatal(err)
+	}
+	results, err := dst.ImportBundle(bytes.NewReader(bundle.Bytes()), "passphrase", dstKey, ImportOptions{Dest: "in", Policy: ConflictRename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("%s: %v", result.Name, result.Err)
+		}
+	}
+	for name, want := range map[string]string{
+		"in/top.txt":        "already here",
+		"in/top (1).txt":    "top",
+		"in/docs/a.txt":     "docs/a.txt",
+		"in/docs/sub/b.txt": "docs/sub/b.txt",
+	} {
+		if data, err := readEntry(dst, name, dstKey); err != nil || data != want {
+			t.Errorf("%s holds %q, %v; want %q", name, data, err, want)
+		}
+	}
+	got, err := dst.Metadata("in/top (1).txt", dstKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Mode.Perm() != 0640 || got.Note != "the top one" {
+		t.Errorf("metadata not kept: mode %v, note %q", got.Mode, got.Note)
+	}
+
+	results, err = dst.ImportBundle(bytes.NewReader(bundle.Bytes()), "passphrase", dstKey, ImportOptions{Dest: "in", Policy: ConflictSkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Action != ExtractSkipped {
+			t.Errorf("%s was %s, want skipped", result.Name, result.Action)
+		}
+	}
+
+	if _, err := dst.ImportBundle(bytes.NewReader(bundle.Bytes()), "passphrase", dstKey, ImportOptions{Dest: "in", Policy: ConflictOverwrite}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readEntry(dst, "in/top.txt", dstKey); err != nil || data != "top" {
+		t.Errorf("overwritten entry holds %q, %v", data, err)
+	}
+	if versions, err := dst.Versions("in/top.txt", dstKey); err != nil || len(versions) != 2 {
+		t.Errorf("overwriting kept %d versions, want 2: %v", len(versions), err)
+	}
+}
+
+// craftBundle returns a bundle with the given key derivation and no
+// entries.
+func craftBundle(t *testing.T, kdf KDFParams) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.Write(bundleMagic)
+	binary.Write(&buf, binary.BigEndian, uint16(bundleVersion))
+	if err := gob.NewEncoder(&buf).Encode(bundleHeader{KDF: kdf}); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(make([]byte, 64))
+	return buf.Bytes()
+}
+
+func TestImportBundleKDFBounds(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	good := KDFParams{Algorithm: KDFArgon2id, Salt: make([]byte, 16), Memory: 64, Time: 1, Threads: 1}
+
+	for name, change := range map[string]func(*KDFParams){
+		"too much memory": func(kdf *KDFParams) { kdf.Memory = kdfMaxMemory + 1 },
+		"too many passes": func(kdf *KDFParams) { kdf.Time = argon2MaxTime + 1 },
+		"no passes":       func(kdf *KDFParams) { kdf.Time = 0 },
+		"no threads":      func(kdf *KDFParams) { kdf.Threads = 0 },
+		"scrypt":          func(kdf *KDFParams) { kdf.Algorithm, kdf.N, kdf.R, kdf.P = KDFScrypt, 1<<30, 8, 1 },
+	} {
+		kdf := good
+		change(&kdf)
+		// The header is rejected before any key is derived, so the
+		// passphrase is never found to be wrong.
+		results, err := vault.ImportBundle(bytes.NewReader(craftBundle(t, kdf)), "passphrase", key, ImportOptions{})
+		if err == nil || strings.Contains(err.Error(), "passphrase") || len(results) != 0 {
+			t.Errorf("%s: imported %v, %v", name, results, err)
+		}
+	}
+
+	_, err := vault.ImportBundle(bytes.NewReader(craftBundle(t, good)), "passphrase", key, ImportOptions{})
+	if err == nil || !strings.Contains(err.Error(), "passphrase") {
+		t.Errorf("importing a bundle without a stream returned %v", err)
+	}
+	if files, _ := vault.List(key); len(files) != 0 {
+		t.Errorf("crafted bundles added %d entries", len(files))
+	}
+}
@@ -0,0 +1,128 @@
+package vault
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// nameCache remembers the decrypted names and metadata of entries for as
+// long as the vault is open, so listing and looking up entries does not
+// decrypt every name again. It is keyed by ciphertext, which is never
+// reused, so changes to the vault need no invalidation.
+type nameCache struct {
+	mu    sync.Mutex
+	key   []byte
+	names map[string]string
+	meta  map[metaKey]Metadata
+}
+
+// metaKey identifies sealed metadata along with the entry it was opened
+// for, so metadata moved to another entry is still rejected.
+type metaKey struct {
+	index uint64
+	name  string
+	meta  string
+}
+
+// forKey empties the cache if it was filled using a different key. The
+// caller must hold cache.mu.
+func (cache *nameCache) forKey(key []byte) {
+	if cache.names != nil && bytes.Equal(cache.key, key) {
+		return
+	}
+	cache.key = append([]byte(nil), key...)
+	cache.names = make(map[string]string)
+	cache.meta = make(map[metaKey]Metadata)
+}
+
+func (cache *nameCache) name(key []byte, encryptedName string) (string, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.forKey(key)
+	if name, ok := cache.names[encryptedName]; ok {
+		return name, nil
+	}
+
+	name, err := DecryptFileName(key, encryptedName)
+	if err != nil {
+		return "", err
+	}
+	cache.names[encryptedName] = name
+	return name, nil
+}
+
+func (cache *nameCache) metadata(key []byte, index uint64, encryptedName string, sealed []byte) (Metadata, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.forKey(key)
+	k := metaKey{index, encryptedName, string(sealed)}
+	if meta, ok := cache.meta[k]; ok {
+		return meta, nil
+	}
+
+	meta, err := openMetadata(key, index, encryptedName, sealed)
+	if err != nil {
+		return meta, err
+	}
+	cache.meta[k] = meta
+	return meta, nil
+}
+
+// clear forgets everything, including the key.
+func (cache *nameCache) clear() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	clear(cache.key)
+	cache.key = nil
+	cache.names = nil
+	cache.meta = nil
+}
+
+// decryptName returns the name of an entry or folder.
+func (vault *Vault) decryptName(key []byte, encryptedName string) (string, error) {
+	return vault.cache.name(key, encryptedName)
+}
+
+// fileMetadata returns the decrypted metadata of file.
+func (vault *Vault) fileMetadata(key []byte, file FileEntry) (Metadata, error) {
+	return vault.cache.metadata(key, file.Index, file.Name, file.Meta)
+}
+
+// FileInfo is the decrypted name and metadata of an entry. Index never
+// changes for the life of the entry.
+type FileInfo struct {
+	Index uint64
+	Name  string
+	Hash  string
+	Metadata
+}
+
+// List returns the name and metadata of every entry, sorted by name.
+// Nothing is decrypted that was already decrypted earlier in the session,
+// so it stays cheap to call for large vaults.
+func (vault *Vault) List(key []byte) ([]FileInfo, error) {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+
+	infos := make([]FileInfo, 0, len(vault.Files))
+	for _, file := range vault.Files {
+		name, err := vault.decryptName(key, file.Name)
+		if err != nil {
+			return nil, err
+		}
+		meta, err := vault.fileMetadata(key, file)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, FileInfo{Index: file.Index, Name: name, Hash: file.Hash, Metadata: meta})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos, nil
+}
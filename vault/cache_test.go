@@ -0,0 +1,111 @@
+package vault
+
+import (
+	"fmt"
+	"testing"
+)
+
+// listedNotes returns the note of each listed entry by name.
+func listedNotes(t *testing.T, vault *Vault, key []byte) map[string]string {
+	t.Helper()
+	files, err := vault.List(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes := make(map[string]string, len(files))
+	for _, file := range files {
+		notes[file.Name] = file.Note
+	}
+	return notes
+}
+
+func TestListFollowsChanges(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	if err := vault.AddFile("a.txt", []byte("a"), key); err != nil {
+		t.Fatal(err)
+	}
+	if notes := listedNotes(t, vault, key); len(notes) != 1 {
+		t.Fatalf("listed %v", notes)
+	}
+
+	if err := vault.AddFile("b.txt", []byte("b"), key); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := listedNotes(t, vault, key)["b.txt"]; !ok {
+		t.Error("an added entry is not listed")
+	}
+
+	if err := vault.SetNote("a.txt", "note", key); err != nil {
+		t.Fatal(err)
+	}
+	if note := listedNotes(t, vault, key)["a.txt"]; note != "note" {
+		t.Errorf("listed note %q after setting it", note)
+	}
+
+	if err := vault.Rename("a.txt", "c.txt", key); err != nil {
+		t.Fatal(err)
+	}
+	notes := listedNotes(t, vault, key)
+	if _, ok := notes["a.txt"]; ok || notes["c.txt"] != "note" {
+		t.Errorf("listed %v after renaming a.txt to c.txt", notes)
+	}
+
+	if err := vault.RemoveFile("b.txt", key); err != nil {
+		t.Fatal(err)
+	}
+	if notes := listedNotes(t, vault, key); len(notes) != 1 {
+		t.Errorf("listed %v after removing b.txt", notes)
+	}
+
+	// A different key starts over instead of returning what the old one
+	// decrypted.
+	if _, err := vault.List(make([]byte, 32)); err == nil {
+		t.Error("listed with the wrong key")
+	}
+	if notes := listedNotes(t, vault, key); notes["c.txt"] != "note" {
+		t.Errorf("listed %v after using the wrong key", notes)
+	}
+}
+
+func BenchmarkList(b *testing.B) {
+	vault, key, _ := newTestVault(b)
+
+	// The entries are made up directly, as only names and metadata are
+	// listed.
+	const entries = 10000
+	for i := 0; i < entries; i++ {
+		name, err := EncryptFileName(key, fmt.Sprintf("folder%d/file%d.txt", i%100, i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		index := uint64(i + 1)
+		meta, err := sealMetadata(key, index, name, Metadata{Size: int64(i), ContentType: "text/plain"})
+		if err != nil {
+			b.Fatal(err)
+		}
+		vault.Files = append(vault.Files, FileEntry{Index: index, Name: name, Meta: meta})
+	}
+
+	list := func(b *testing.B) {
+		files, err := vault.List(key)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(files) != entries {
+			b.Fatalf("listed %d entries", len(files))
+		}
+	}
+	b.Run("cached", func(b *testing.B) {
+		list(b)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			list(b)
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			vault.cache.clear()
+			list(b)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package vault
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Codecs a body can be compressed with before it is encrypted. The codec
+// of each body is recorded in its entry's metadata.
+const (
+	CodecNone = ""
+	CodecGzip = "gzip"
+)
+
+// Codecs lists the codecs Settings.Compression can be set to.
+var Codecs = []string{CodecNone, CodecGzip}
+
+func checkCodec(codec string) error {
+	for _, known := range Codecs {
+		if codec == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported codec %q", codec)
+}
+
+// compressedTypes are content types whose bodies are already compressed,
+// so compressing them again costs time and saves nothing.
+var compressedTypes = []string{
+	"image/",
+	"audio/",
+	"video/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/vnd.rar",
+	"application/x-rar-compressed",
+	"application/zstd",
+	"application/pdf",
+	"application/vnd.openxmlformats-officedocument.",
+	"application/vnd.oasis.opendocument.",
+	"application/epub+zip",
+	"application/java-archive",
+}
+
+// codecFor returns the codec to store a body of contentType with, which is
+// the vault's default unless the body is already compressed.
+func (vault *Vault) codecFor(contentType string) string {
+	for _, prefix := range compressedTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return CodecNone
+		}
+	}
+
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+	return vault.Options.Compression
+}
+
+// compressWriter returns a writer that compresses into w with codec.
+func compressWriter(w io.Writer, codec string) (io.WriteCloser, error) {
+	switch codec {
+	case CodecNone:
+		return nopWriteCloser{w}, nil
+	case CodecGzip:
+		return gzip.NewWriter(w), nil
+	}
+	return nil, checkCodec(codec)
+}
+
+// decompressReader returns a reader that decompresses r with codec.
+func decompressReader(r io.Reader, codec string) (io.Reader, error) {
+	switch codec {
+	case CodecNone:
+		return r, nil
+	case CodecGzip:
+		return gzip.NewReader(r)
+	}
+	return nil, checkCodec(codec)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	body := strings.Repeat("a line that compresses well\n", 1000)
+	for _, codec := range Codecs {
+		name := codec
+		if name == CodecNone {
+			name = "none"
+		}
+		t.Run(name, func(t *testing.T) {
+			vault, key, vaultPath := newTestVault(t)
+			if err := vault.SetSettings(Settings{Compression: codec}, key); err != nil {
+				t.Fatal(err)
+			}
+			if err := vault.AddFile("notes.txt", []byte(body), key); err != nil {
+				t.Fatal(err)
+			}
+			meta, err := vault.Metadata("notes.txt", key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Codec != codec || meta.Size != int64(len(body)) {
+				t.Errorf("codec %q, size %d", meta.Codec, meta.Size)
+			}
+			info, err := os.Stat(vault.blobPath(vault.Files[0].Blob))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compressed := info.Size() < int64(len(body))/10; compressed != (codec != CodecNone) {
+				t.Errorf("blob of %d bytes for a %d byte body", info.Size(), len(body))
+			}
+
+			if err := vault.Save(vaultPath); err != nil {
+				t.Fatal(err)
+			}
+			vault.Close()
+			reopened, key, err := OpenVault(vaultPath, testPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+			if data, err := readEntry(reopened, "notes.txt", key); err != nil || data != body {
+				t.Errorf("extracted %d bytes, %v", len(data), err)
+			}
+		})
+	}
+}
+
+func TestCompressSkipsCompressedTypes(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	if err := vault.SetSettings(Settings{Compression: CodecGzip}, key); err != nil {
+		t.Fatal(err)
+	}
+
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte(strings.Repeat("compressed already ", 100)))
+	zw.Close()
+	filler := strings.Repeat("x", 1000)
+
+	for name, test := range map[string]struct {
+		body  string
+		codec string
+	}{
+		"photo.jpg":  {filler, CodecNone},
+		"scan.pdf":   {filler, CodecNone},
+		"image.png":  {"\x89PNG\r\n\x1a\n" + filler, CodecNone},
+		"archive":    {gzipped.String(), CodecNone},
+		"readme.txt": {filler, CodecGzip},
+		"data":       {filler, CodecGzip},
+	} {
+		if err := vault.AddFile(name, []byte(test.body), key); err != nil {
+			t.Fatal(err)
+		}
+		meta, err := vault.Metadata(name, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Codec != test.codec {
+			t.Errorf("%s (%s) stored with codec %q, want %q", name, meta.ContentType, meta.Codec, test.codec)
+		}
+		if data, err := readEntry(vault, name, key); err != nil || data != test.body {
+			t.Errorf("%s: extracted %d bytes, %v", name, len(data), err)
+		}
+	}
+}
+
+func TestCheckCodec(t *testing.T) {
+	for _, codec := range Codecs {
+		if err := checkCodec(codec); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := checkCodec("zstd"); err == nil {
+		t.Error("zstd was accepted")
+	}
+	if _, err := compressWriter(io.Discard, "zstd"); err == nil {
+		t.Error("compressed with zstd")
+	}
+	if _, err := decompressReader(strings.NewReader(""), "zstd"); err == nil {
+		t.Error("decompressed with zstd")
+	}
+
+	vault, key, _ := newTestVault(t)
+	if err := vault.SetSettings(Settings{Compression: "zstd"}, key); err == nil {
+		t.Error("set compression to zstd")
+	}
+	if codec := vault.Settings().Compression; codec != CodecNone {
+		t.Errorf("compression is %q after refusing zstd", codec)
+	}
+
+	// A body whose metadata names an unknown codec is refused rather than
+	// returned as it is stored.
+	if err := vault.AddFile("a.txt", []byte("a"), key); err != nil {
+		t.Fatal(err)
+	}
+	file := vault.Files[0]
+	meta, err := vault.Metadata("a.txt", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.Codec = "zstd"
+	if vault.Files[0].Meta, err = sealMetadata(key, file.Index, file.Name, meta); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readEntry(vault, "a.txt", key); err == nil {
+		t.Errorf("extracted %q with an unknown codec", data)
+	}
+}
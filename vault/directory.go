@@ -0,0 +1,179 @@
+package vault
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// AddDirectoryOptions controls which files AddDirectory adds and where.
+//
+// Patterns use path.Match syntax. A pattern containing a slash is matched
+// against the path relative to the directory being added, otherwise
+// against the base name. Exclude patterns also skip whole folders.
+type AddDirectoryOptions struct {
+	// Dest is the vault folder the directory is added to. Empty is the
+	// vault root.
+	Dest    string
+	Include []string
+	Exclude []string
+	// Progress, if set, is called after each file is added.
+	Progress func(done, total int, fileName string)
+}
+
+// AddDirectory adds every regular file under root, keeping its path
+// relative to root's parent along with its mode and modification time.
+// Folders are created even if nothing in them is added. It stops at the
+// first file that cannot be added; files added before it stay in the
+// vault. It returns the names of the added entries.
+func (vault *Vault) AddDirectory(root string, key []byte, opts AddDirectoryOptions) ([]string, error) {
+	if vault.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	for _, patterns := range [][]string{opts.Include, opts.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+			}
+		}
+	}
+
+	// Relative roots such as "." or ".." are named after the folder they
+	// refer to.
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %v", err)
+	}
+	base := addBase(root, opts.Dest)
+
+	var dirs, files []string
+	err = filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel != "." && matchesAny(opts.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, rel)
+			return nil
+		}
+		if !d.Type().IsRegular() || matchesAny(opts.Exclude, rel) {
+			return nil
+		}
+		if len(opts.Include) > 0 && !matchesAny(opts.Include, rel) {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %v", err)
+	}
+
+	if err := vault.mkdirs(base, dirs, key); err != nil {
+		return nil, err
+	}
+
+	var added []string
+	for i, rel := range files {
+		fileName := path.Join(base, rel)
+		if err := vault.addFromDisk(filepath.Join(root, filepath.FromSlash(rel)), fileName, key); err != nil {
+			return added, fmt.Errorf("failed to add %s: %v", rel, err)
+		}
+		added = append(added, fileName)
+
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(files), fileName)
+		}
+	}
+	return added, nil
+}
+
+// addBase returns the vault folder the contents of root are added to:
+// root's own name under dest, or dest itself if root is the root of the
+// filesystem, which has no name. The vault root is "".
+func addBase(root, dest string) string {
+	if filepath.Dir(root) != root {
+		dest = path.Join(dest, filepath.Base(root))
+	}
+	base, err := cleanPath(dest)
+	if err != nil {
+		return ""
+	}
+	return base
+}
+
+func (vault *Vault) addFromDisk(diskPath, fileName string, key []byte) error {
+	file, err := os.Open(diskPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return vault.AddFileWithMetadata(fileName, file, NewMetadata(info), key)
+}
+
+// mkdirs creates base and each folder in rels below it that does not
+// exist yet. base is "" for the vault root.
+func (vault *Vault) mkdirs(base string, rels []string, key []byte) error {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	files, dirs, err := vault.paths(key)
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range rels {
+		if path.Join(base, rel) == "." {
+			// The vault root always exists.
+			continue
+		}
+		dir, err := cleanPath(path.Join(base, rel))
+		if err != nil {
+			return err
+		}
+		if dirs[dir] {
+			continue
+		}
+		if err := checkNewPath(dir, files, dirs); err != nil {
+			return fmt.Errorf("failed to create folder %s: %v", dir, err)
+		}
+
+		encryptedDir, err := EncryptFileName(key, dir)
+		if err != nil {
+			return err
+		}
+		vault.Dirs = append(vault.Dirs, encryptedDir)
+		dirs[dir] = true
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// makeTree creates a folder named contracts with a few files in it and
+// returns its path.
+func makeTree(t *testing.T) string {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "contracts")
+	for _, dir := range []string{"a/b", ".git", "empty"} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, mode := range map[string]os.FileMode{
+		"x.pdf":     0600,
+		"a/b/y.pdf": 0640,
+		"a/z.tmp":   0644,
+		".git/HEAD": 0644,
+	} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// chdir changes the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestAddDirectory(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	root := makeTree(t)
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(root, "x.pdf"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress [][2]int
+	added, err := vault.AddDirectory(root, key, AddDirectoryOptions{
+		Dest:    "/in",
+		Exclude: []string{".git", "*.tmp"},
+		Progress: func(done, total int, fileName string) {
+			progress = append(progress, [2]int{done, total})
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(added)
+	if want := []string{"in/contracts/a/b/y.pdf", "in/contracts/x.pdf"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added %v, want %v", added, want)
+	}
+	if want := [][2]int{{1, 2}, {2, 2}}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("progress %v, want %v", progress, want)
+	}
+
+	dirs, err := vault.ListDirs(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"in", "in/contracts", "in/contracts/a", "in/contracts/a/b", "in/contracts/empty"}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("folders %v, want %v", dirs, want)
+	}
+
+	meta, err := vault.Metadata("in/contracts/x.pdf", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Mode.Perm() != 0600 || !meta.ModTime.Equal(modTime) {
+		t.Errorf("metadata not kept: mode %v, modified %v", meta.Mode, meta.ModTime)
+	}
+}
+
+func TestAddDirectoryRelativeRoots(t *testing.T) {
+	root := makeTree(t)
+	opts := AddDirectoryOptions{Exclude: []string{".git", "*.tmp"}}
+	want := []string{"contracts/a/b/y.pdf", "contracts/x.pdf"}
+
+	for _, test := range []struct {
+		name, dir, root string
+	}{
+		{"dot", root, "."},
+		{"dot dot", filepath.Join(root, "a"), ".."},
+		{"trailing slash", filepath.Dir(root), "contracts" + string(filepath.Separator)},
+		{"absolute with trailing slash", "", root + string(filepath.Separator)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			vault, key, _ := newTestVault(t)
+			if test.dir != "" {
+				chdir(t, test.dir)
+			}
+
+			added, err := vault.AddDirectory(test.root, key, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(added)
+			if !reflect.DeepEqual(added, want) {
+				t.Errorf("added %v, want %v", added, want)
+			}
+		})
+	}
+}
+
+func TestAddBase(t *testing.T) {
+	fsRoot, err := filepath.Abs(string(filepath.Separator))
+	if err != nil {
+		t.Fatal(err)
+	}
+	named := filepath.Join(fsRoot, "home", "contracts")
+
+	for _, test := range []struct {
+		root, dest, want string
+	}{
+		{named, "", "contracts"},
+		{named, "/in/", "in/contracts"},
+		{fsRoot, "", ""},
+		{fsRoot, "/", ""},
+		{fsRoot, "in", "in"},
+	} {
+		if got := addBase(test.root, test.dest); got != test.want {
+			t.Errorf("addBase(%q, %q) = %q, want %q", test.root, test.dest, got, test.want)
+		}
+	}
+}
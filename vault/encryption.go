@@ -1,22 +1,23 @@
 package vault
 
 import (
-	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-
-	"golang.org/x/crypto/scrypt"
 )
 
-func DeriveKey(password string, salt []byte) ([]byte, error) {
-	return scrypt.Key([]byte(password), salt, 16384, 8, 1, 32)
-}
+const (
+	// CipherAESCBC is the unauthenticated format used by vaults written
+	// before entries were sealed with an AEAD. It is only ever decrypted.
+	CipherAESCBC = "aes-256-cbc"
+	CipherAESGCM = "aes-256-gcm"
+)
 
 func GenerateSalt() ([]byte, error) {
 	salt := make([]byte, 16)
@@ -25,7 +26,7 @@ func GenerateSalt() ([]byte, error) {
 }
 
 func EncryptFileName(key []byte, fileName string) (string, error) {
-	encryptedFileName, err := EncryptData(key, []byte(fileName))
+	encryptedFileName, err := EncryptData(key, []byte(fileName), nil)
 	if err != nil {
 		return "", err
 	}
@@ -37,34 +38,81 @@ func DecryptFileName(key []byte, encryptedFileName string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	decryptedFileName, err := DecryptData(key, encryptedFileNameBytes)
+	decryptedFileName, err := DecryptData(key, encryptedFileNameBytes, nil)
 	if err != nil {
 		return "", err
 	}
 	return string(decryptedFileName), nil
 }
 
-func EncryptData(key, plaintext []byte) ([]byte, error) {
+// EncryptData seals plaintext with AES-256-GCM. The random nonce is
+// prepended to the returned ciphertext, and additionalData must be passed
+// unchanged to DecryptData for the ciphertext to open.
+func EncryptData(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
 
-	block, err := aes.NewCipher(key)
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func DecryptData(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
 	if err != nil {
 		return nil, err
 	}
-	plaintext = pkcs7Pad(plaintext, aes.BlockSize)
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
 
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce := ciphertext[:aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, ciphertext[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("message authentication failed")
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
 		return nil, err
 	}
+	return cipher.NewGCM(block)
+}
 
-	mode := cipher.NewCBCEncrypter(block, iv)
-	mode.CryptBlocks(ciphertext[aes.BlockSize:], plaintext)
+// entryAD is the associated data a file body is sealed with. It ties the
+// body to the entry's index and encrypted name, so bodies cannot be moved
+// between entries without failing authentication.
+func entryAD(index uint64, encryptedFileName string) []byte {
+	ad := make([]byte, 8, 8+len(encryptedFileName))
+	binary.BigEndian.PutUint64(ad, index)
+	return append(ad, encryptedFileName...)
+}
 
-	return ciphertext, nil
+func decryptLegacyFileName(key []byte, encryptedFileName string) (string, error) {
+	encryptedFileNameBytes, err := base64.StdEncoding.DecodeString(encryptedFileName)
+	if err != nil {
+		return "", err
+	}
+	decryptedFileName, err := decryptLegacyData(key, encryptedFileNameBytes)
+	if err != nil {
+		return "", err
+	}
+	return string(decryptedFileName), nil
 }
 
-func DecryptData(key, ciphertext []byte) ([]byte, error) {
+// decryptLegacyData opens AES-CBC ciphertext written by older versions.
+// Nothing is encrypted in this format any more.
+func decryptLegacyData(key, ciphertext []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -81,10 +129,11 @@ func DecryptData(key, ciphertext []byte) ([]byte, error) {
 		return nil, fmt.Errorf("ciphertext is not a multiple of the block size")
 	}
 
+	plaintext := make([]byte, len(ciphertext))
 	mode := cipher.NewCBCDecrypter(block, iv)
-	mode.CryptBlocks(ciphertext, ciphertext)
+	mode.CryptBlocks(plaintext, ciphertext)
 
-	plaintext, err := pkcs7Unpad(ciphertext, aes.BlockSize)
+	plaintext, err = pkcs7Unpad(plaintext, aes.BlockSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unpad ciphertext: %v", err)
 	}
@@ -92,12 +141,6 @@ func DecryptData(key, ciphertext []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
-func pkcs7Pad(data []byte, blockSize int) []byte {
-	padding := blockSize - len(data)%blockSize
-	padtext := bytes.Repeat([]byte{byte(padding)}, padding)
-	return append(data, padtext...)
-}
-
 func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
 	if len(data) == 0 || len(data)%blockSize != 0 {
 		return nil, errors.New("invalid padding size")
@@ -0,0 +1,127 @@
+package vault
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// legacyPassword unlocks testdata/legacy-cbc.vault, a vault written by the
+// first release: a bare gob-encoded vault with scrypt, a key hash and
+// AES-CBC entries.
+const legacyPassword = "legacy password"
+
+// copyFixture copies the vault file testdata/name into a temporary
+// directory, so it can be upgraded, and returns its path.
+func copyFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vaultPath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(vaultPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return vaultPath
+}
+
+func TestOpenLegacyCBCVault(t *testing.T) {
+	vaultPath := copyFixture(t, "legacy-cbc.vault")
+	if _, _, err := OpenVault(vaultPath, "wrong password"); err == nil {
+		t.Fatal("opened with the wrong password")
+	}
+
+	vault, key, err := OpenVault(vaultPath, legacyPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"notes.txt": "written before entries were authenticated\n",
+		"empty.txt": "",
+		"block.bin": "0123456789abcdef",
+	}
+	for name, body := range want {
+		if data, err := readEntry(vault, name, key); err != nil || data != body {
+			t.Errorf("%s holds %q, %v; want %q", name, data, err, body)
+		}
+	}
+	vault.Close()
+
+	// The upgrade was saved: the file now holds AES-GCM entries under a
+	// wrapped master key.
+	saved, err := readVaultFile(vaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.header.Cipher != CipherAESGCM || len(saved.header.WrappedKey) == 0 || saved.formatVersion != FormatVersion {
+		t.Errorf("saved header %+v, format version %d", saved.header, saved.formatVersion)
+	}
+	for _, file := range saved.Files {
+		if len(file.Data) != 0 || file.Blob == "" {
+			t.Errorf("entry %d still holds its body inline", file.Index)
+		}
+	}
+
+	reopened, key, err := OpenVaultReadOnly(vaultPath, legacyPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for name, body := range want {
+		if data, err := readEntry(reopened, name, key); err != nil || data != body {
+			t.Errorf("after reopening, %s holds %q, %v", name, data, err)
+		}
+	}
+}
+
+func TestBodyBoundToEntry(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := vault.AddFile(name, []byte("body of "+name), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := vault.Files[0], vault.Files[1]
+
+	// b pointing at a's body does not match b's sealed content ID.
+	vault.Files[1].Blob, vault.Files[1].Hash = a.Blob, a.Hash
+	if data, err := readEntry(vault, "b.txt", key); err == nil {
+		t.Errorf("b.txt read a's body: %q", data)
+	}
+
+	// Taking a's metadata along does not help, as it is sealed to a's
+	// index and name.
+	vault.Files[1].Meta = a.Meta
+	vault.cache.clear()
+	if data, err := readEntry(vault, "b.txt", key); err == nil {
+		t.Errorf("b.txt read a's body with a's metadata: %q", data)
+	}
+
+	vault.Files[1] = b
+	vault.cache.clear()
+	if data, err := readEntry(vault, "b.txt", key); err != nil || data != "body of b.txt" {
+		t.Errorf("b.txt holds %q, %v after putting it back", data, err)
+	}
+}
+
+func TestEntryAD(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	sealed, err := EncryptData(key, []byte("body"), entryAD(1, "name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptData(key, sealed, entryAD(1, "name")); err != nil {
+		t.Fatal(err)
+	}
+	for _, ad := range [][]byte{entryAD(2, "name"), entryAD(1, "other"), nil} {
+		if _, err := DecryptData(key, sealed, ad); err == nil {
+			t.Errorf("opened with associated data %q", ad)
+		}
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := DecryptData(key, sealed, entryAD(1, "name")); err == nil {
+		t.Error("opened a tampered ciphertext")
+	}
+}
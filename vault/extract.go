@@ -0,0 +1,226 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ConflictPolicy says what ExtractTree does when a file it is about to
+// write already exists.
+type ConflictPolicy int
+
+const (
+	// ConflictOverwrite replaces the existing file.
+	ConflictOverwrite ConflictPolicy = iota
+	// ConflictSkip leaves the existing file and does not extract the entry.
+	ConflictSkip
+	// ConflictRename extracts the entry next to the existing file under a
+	// name such as "report (1).pdf".
+	ConflictRename
+)
+
+// What happened to an entry during ExtractTree.
+const (
+	ExtractCreated     = "created"
+	ExtractOverwritten = "overwritten"
+	ExtractSkipped     = "skipped"
+	ExtractRenamed     = "renamed"
+	ExtractFailed      = "failed"
+)
+
+// ExtractResult reports what ExtractTree did with one entry. Path is where
+// the entry was written, or would have been for skipped and failed ones.
+type ExtractResult struct {
+	Name   string
+	Path   string
+	Action string
+	Err    error
+}
+
+// ExtractAll extracts every entry in the vault into outputDir.
+func (vault *Vault) ExtractAll(outputDir string, key []byte, policy ConflictPolicy) ([]ExtractResult, error) {
+	return vault.ExtractTree("", outputDir, key, policy)
+}
+
+// ExtractTree extracts the folder dirPath and everything in it into
+// outputDir, recreating its folders and restoring each file's permissions
+// and modification time where they were recorded. An empty dirPath is the
+// whole vault. The folder itself is created in outputDir, so extracting
+// "projects/acme" writes "acme/...".
+//
+// A file that cannot be extracted does not stop the others; the results
+// say what happened to each entry. The error is only set if extraction
+// could not start.
+func (vault *Vault) ExtractTree(dirPath, outputDir string, key []byte, policy ConflictPolicy) ([]ExtractResult, error) {
+	prefix := ""
+	if dirPath != "" {
+		var err error
+		if dirPath, err = cleanPath(dirPath); err != nil {
+			return nil, err
+		}
+		prefix = path.Dir(dirPath) + "/"
+		if prefix == "./" {
+			prefix = ""
+		}
+	}
+
+	vault.mu.RLock()
+	entries := make(map[string]FileEntry)
+	var names []string
+	for _, file := range vault.Files {
+		fileName, err := vault.decryptName(key, file.Name)
+		if err != nil {
+			vault.mu.RUnlock()
+			return nil, fmt.Errorf("failed to decrypt filename: %v", err)
+		}
+		if dirPath == "" || isUnder(fileName, dirPath) {
+			entries[fileName] = file
+			names = append(names, fileName)
+		}
+	}
+	_, dirs, err := vault.paths(key)
+	vault.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if dirPath != "" && !dirs[dirPath] {
+		return nil, fmt.Errorf("folder not found: %s", dirPath)
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+	for dir := range dirs {
+		if dirPath != "" && !isUnder(dir, dirPath) {
+			continue
+		}
+		if err := os.MkdirAll(extractPath(outputDir, dir, prefix), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %v", err)
+		}
+	}
+
+	sort.Strings(names)
+	results := make([]ExtractResult, 0, len(names))
+	for _, fileName := range names {
+		result := ExtractResult{
+			Name: fileName,
+			Path: extractPath(outputDir, fileName, prefix),
+		}
+		result.Path, result.Action, result.Err = vault.extractEntry(entries[fileName], fileName, result.Path, key, policy)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ExtractFiles extracts the named entries into outputDir, each under its
+// base name, in the same way as ExtractTree.
+func (vault *Vault) ExtractFiles(fileNames []string, outputDir string, key []byte, policy ConflictPolicy) ([]ExtractResult, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	results := make([]ExtractResult, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		result := ExtractResult{
+			Name: fileName,
+			Path: extractPath(outputDir, path.Base(fileName), ""),
+		}
+
+		vault.mu.RLock()
+		i, err := vault.findFile(fileName, key)
+		var file FileEntry
+		if err == nil {
+			file = vault.Files[i]
+		}
+		vault.mu.RUnlock()
+
+		if err != nil {
+			result.Action, result.Err = ExtractFailed, err
+		} else {
+			result.Path, result.Action, result.Err = vault.extractEntry(file, fileName, result.Path, key, policy)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// extractPath returns where the entry named name is written in outputDir.
+// Names are cleaned when entries are added, and again here, so that even a
+// crafted entry cannot be written outside outputDir.
+func extractPath(outputDir, name, prefix string) string {
+	rel := path.Clean("/" + strings.ReplaceAll(strings.TrimPrefix(name, prefix), "\\", "/"))
+	return filepath.Join(outputDir, filepath.FromSlash(rel))
+}
+
+// extractEntry writes file to outputPath, applying policy if something is
+// already there. It returns the path written and what was done.
+func (vault *Vault) extractEntry(file FileEntry, fileName, outputPath string, key []byte, policy ConflictPolicy) (string, string, error) {
+	meta, err := vault.fileMetadata(key, file)
+	if err != nil {
+		return outputPath, ExtractFailed, err
+	}
+
+	action := ExtractCreated
+	if _, err := os.Lstat(outputPath); err == nil {
+		switch policy {
+		case ConflictSkip:
+			return outputPath, ExtractSkipped, nil
+		case ConflictRename:
+			outputPath = freePath(outputPath)
+			action = ExtractRenamed
+		default:
+			action = ExtractOverwritten
+		}
+	}
+
+	// The body goes to a temporary file first, so a failed extraction
+	// never leaves a partial file or destroys the one being overwritten.
+	tmp, err := os.CreateTemp(filepath.Dir(outputPath), ".extract-")
+	if err != nil {
+		return outputPath, ExtractFailed, err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = vault.copyContent(key, file, file.current(), fileName, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return outputPath, ExtractFailed, err
+	}
+
+	mode := os.FileMode(0644)
+	if meta.Mode != 0 {
+		mode = meta.Mode.Perm()
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return outputPath, ExtractFailed, err
+	}
+	if !meta.ModTime.IsZero() {
+		if err := os.Chtimes(tmp.Name(), meta.ModTime, meta.ModTime); err != nil {
+			return outputPath, ExtractFailed, err
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), outputPath); err != nil {
+		return outputPath, ExtractFailed, err
+	}
+	return outputPath, action, nil
+}
+
+// freePath returns the first of "name (1).ext", "name (2).ext", ... that
+// does not exist.
+func freePath(filePath string) string {
+	ext := filepath.Ext(filePath)
+	base := strings.TrimSuffix(filePath, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package vault
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readDiskFile(t *testing.T, filePath string) string {
+	t.Helper()
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestExtractTree(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	meta := Metadata{Mode: 0750, ModTime: modTime}
+	if err := vault.AddFileWithMetadata("proj/a/x.sh", bytes.NewReader([]byte("x")), meta, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.AddFile("proj/b.txt", []byte("b"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Mkdir("proj/a/empty", key); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	results, err := vault.ExtractTree("proj/a", out, key, ConflictOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Action != ExtractCreated || results[0].Err != nil {
+		t.Fatalf("results %+v", results)
+	}
+
+	// The folder itself is created, without the folders above it.
+	info, err := os.Stat(filepath.Join(out, "a", "x.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0750 || !info.ModTime().Equal(modTime) {
+		t.Errorf("mode %v and modification time %v not restored", info.Mode(), info.ModTime())
+	}
+	if info, err := os.Stat(filepath.Join(out, "a", "empty")); err != nil || !info.IsDir() {
+		t.Errorf("empty folder not extracted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "b.txt")); !os.IsNotExist(err) {
+		t.Error("file outside the folder was extracted")
+	}
+
+	if _, err := vault.ExtractTree("nope", out, key, ConflictOverwrite); err == nil {
+		t.Error("extracted a folder that does not exist")
+	}
+}
+
+func TestExtractConflictPolicies(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	if err := vault.AddFile("report.txt", []byte("from vault"), key); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		policy   ConflictPolicy
+		action   string
+		existing string
+		written  string
+	}{
+		{ConflictOverwrite, ExtractOverwritten, "from vault", "report.txt"},
+		{ConflictSkip, ExtractSkipped, "on disk", ""},
+		{ConflictRename, ExtractRenamed, "on disk", "report (1).txt"},
+	} {
+		out := t.TempDir()
+		existing := filepath.Join(out, "report.txt")
+		if err := os.WriteFile(existing, []byte("on disk"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := vault.ExtractAll(out, key, test.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Action != test.action || results[0].Err != nil {
+			t.Errorf("policy %d: results %+v, want %s", test.policy, results, test.action)
+			continue
+		}
+		if got := readDiskFile(t, existing); got != test.existing {
+			t.Errorf("policy %d: existing file holds %q, want %q", test.policy, got, test.existing)
+		}
+		if test.written != "" {
+			written := filepath.Join(out, test.written)
+			if results[0].Path != written {
+				t.Errorf("policy %d: written to %s, want %s", test.policy, results[0].Path, written)
+			}
+			if got := readDiskFile(t, written); got != "from vault" {
+				t.Errorf("policy %d: extracted file holds %q", test.policy, got)
+			}
+		}
+	}
+}
+
+func TestExtractStaysInOutputDir(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+
+	// Names are cleaned when entries are added.
+	if err := vault.AddFile("../../added.txt", []byte("added"), key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readEntry(vault, "added.txt", key); err != nil {
+		t.Errorf("entry not stored under its cleaned name: %v", err)
+	}
+
+	// Crafted entries whose names were never cleaned.
+	for _, name := range []string{"../../escaped.txt", `..\..\escaped-backslash.txt`, "/abs/escaped-abs.txt"} {
+		if err := vault.AddFile("placeholder.txt", []byte(name), key); err != nil {
+			t.Fatal(err)
+		}
+		i := len(vault.Files) - 1
+		crafted, err := renameEntry(key, vault.Files[i], name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vault.Files[i] = crafted
+	}
+
+	parent := t.TempDir()
+	out := filepath.Join(parent, "one", "two")
+	results, err := vault.ExtractAll(out, key, ConflictOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results2, err := vault.ExtractFiles([]string{"../../escaped.txt"}, out, key, ConflictRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range append(results, results2...) {
+		if !isInside(out, result.Path) {
+			t.Errorf("%s was written to %s, outside %s", result.Name, result.Path, out)
+		}
+	}
+	filepath.WalkDir(parent, func(filePath string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !isInside(out, filePath) {
+			t.Errorf("file written outside the output folder: %s", filePath)
+		}
+		return nil
+	})
+}
+
+// isInside reports whether filePath is in dir or below it.
+func isInside(dir, filePath string) bool {
+	rel, err := filepath.Rel(dir, filePath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
@@ -1,7 +1,175 @@
 package vault
 
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// FileEntry is one file in the vault. Its body is stored in the blob named
+// by Blob. Data only holds the body of entries read from vaults written
+// before the blob store, until OpenVault moves it into a blob. Meta holds
+// the entry's Metadata, encrypted, and Versions its earlier bodies.
+//
+// Seq numbers the current body among the entry's versions; see Version.
+//
+// Metadata is only filled in on the decrypted copies returned by
+// ListFiles; it is never set on stored entries.
 type FileEntry struct {
-	Name string
-	Hash string
-	Data []byte
+	Index    uint64
+	Name     string
+	Hash     string
+	Blob     string
+	Data     []byte
+	Meta     []byte
+	Seq      uint64
+	Versions []Version
+	Metadata Metadata
+}
+
+// Metadata describes an entry and the file it was added from. Fields that
+// were not known when the entry was added, or that predate them, are zero.
+type Metadata struct {
+	Size        int64       `json:"size"`
+	Mode        os.FileMode `json:"mode"`
+	ModTime     time.Time   `json:"mod_time"`
+	Added       time.Time   `json:"added"`
+	Updated     time.Time   `json:"updated"`
+	ContentType string      `json:"content_type"`
+	Note        string      `json:"note,omitempty"`
+	// Content is the ID of the blob holding the body, so the metadata
+	// vouches for which body belongs to the entry.
+	Content string `json:"content,omitempty"`
+	// Codec is what the body was compressed with before it was encrypted.
+	Codec string `json:"codec,omitempty"`
+}
+
+// NewMetadata returns the metadata to store for a file on disk. The size,
+// timestamps and content type are filled in when the entry is written.
+func NewMetadata(info os.FileInfo) Metadata {
+	return Metadata{
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}
+}
+
+// bodyReader counts the bytes read through it, so an entry's size is
+// known once its body has been streamed into a blob.
+type bodyReader struct {
+	r    *bufio.Reader
+	size int64
+}
+
+func newBodyReader(r io.Reader) *bodyReader {
+	return &bodyReader{r: bufio.NewReader(r)}
+}
+
+func (br *bodyReader) Read(p []byte) (int, error) {
+	n, err := br.r.Read(p)
+	br.size += int64(n)
+	return n, err
+}
+
+// contentType guesses the type of the body about to be read, from the
+// file name's extension or else from the first bytes of the body.
+func (br *bodyReader) contentType(fileName string) string {
+	if contentType := mime.TypeByExtension(path.Ext(fileName)); contentType != "" {
+		return contentType
+	}
+	head, _ := br.r.Peek(512)
+	return http.DetectContentType(head)
+}
+
+// metadataAD binds an entry's metadata, and through it the entry's body,
+// to the entry's index and encrypted name.
+func metadataAD(index uint64, encryptedName string) []byte {
+	ad := []byte("metadata")
+	ad = binary.BigEndian.AppendUint64(ad, index)
+	return append(ad, encryptedName...)
+}
+
+// legacyMetadataAD is the associated data of metadata written before
+// bodies were deduplicated, which was bound to the index only.
+func legacyMetadataAD(index uint64) []byte {
+	ad := []byte("metadata")
+	return binary.BigEndian.AppendUint64(ad, index)
+}
+
+func sealMetadata(key []byte, index uint64, encryptedName string, meta Metadata) ([]byte, error) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	return EncryptData(key, data, metadataAD(index, encryptedName))
+}
+
+func openMetadata(key []byte, index uint64, encryptedName string, sealed []byte) (Metadata, error) {
+	return decodeMetadata(key, sealed, metadataAD(index, encryptedName))
+}
+
+func openLegacyMetadata(key []byte, index uint64, sealed []byte) (Metadata, error) {
+	return decodeMetadata(key, sealed, legacyMetadataAD(index))
+}
+
+func decodeMetadata(key, sealed, ad []byte) (Metadata, error) {
+	var meta Metadata
+	if len(sealed) == 0 {
+		return meta, nil
+	}
+
+	data, err := DecryptData(key, sealed, ad)
+	if err != nil {
+		return meta, fmt.Errorf("failed to decrypt metadata: %v", err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("failed to decode metadata: %v", err)
+	}
+	return meta, nil
+}
+
+// Metadata returns the metadata of the entry named filePath.
+func (vault *Vault) Metadata(filePath string, key []byte) (Metadata, error) {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+
+	i, err := vault.findFile(filePath, key)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return vault.fileMetadata(key, vault.Files[i])
+}
+
+// SetNote stores a note with the entry named filePath.
+func (vault *Vault) SetNote(filePath, note string, key []byte) error {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	i, err := vault.findFile(filePath, key)
+	if err != nil {
+		return err
+	}
+
+	meta, err := vault.fileMetadata(key, vault.Files[i])
+	if err != nil {
+		return err
+	}
+	meta.Note = note
+
+	sealed, err := sealMetadata(key, vault.Files[i].Index, vault.Files[i].Name, meta)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt metadata: %v", err)
+	}
+	vault.Files[i].Meta = sealed
+	return nil
 }
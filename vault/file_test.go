@@ -0,0 +1,106 @@
+package vault
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetadataSurvivesSave(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+	modTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	body := "<html><body>report</body></html>"
+	meta := Metadata{Mode: 0640, ModTime: modTime}
+	if err := vault.AddFileWithMetadata("docs/report.html", strings.NewReader(body), meta, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.SetNote("docs/report.html", "sent to the auditors", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.SetNote("docs/missing.html", "note", key); err == nil {
+		t.Error("set a note on a missing entry")
+	}
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+
+	reopened, key, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	got, err := reopened.Metadata("docs/report.html", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Note != "sent to the auditors" || got.Mode != 0640 || !got.ModTime.Equal(modTime) || got.Size != int64(len(body)) {
+		t.Errorf("metadata after reopening: %+v", got)
+	}
+	if !strings.HasPrefix(got.ContentType, "text/html") || got.Added.IsZero() || got.Content == "" {
+		t.Errorf("metadata filled in on adding: %+v", got)
+	}
+	if data, err := readEntry(reopened, "docs/report.html", key); err != nil || data != body {
+		t.Errorf("body %q, %v", data, err)
+	}
+
+	// Changing the note leaves the rest alone.
+	if err := reopened.SetNote("docs/report.html", "", key); err != nil {
+		t.Fatal(err)
+	}
+	if cleared, err := reopened.Metadata("docs/report.html", key); err != nil || cleared.Note != "" || cleared.Content != got.Content || !cleared.ModTime.Equal(modTime) {
+		t.Errorf("metadata after clearing the note: %+v, %v", cleared, err)
+	}
+}
+
+func TestMetadataEncrypted(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := vault.AddFile(name, []byte(name), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const note = "the combination is 12-34-56"
+	if err := vault.SetNote("a.txt", note, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{note, "text/plain", "content_type"} {
+		if bytes.Contains(saved, []byte(plain)) {
+			t.Errorf("the vault file contains %q in the clear", plain)
+		}
+	}
+
+	// The sealed metadata only opens for the entry it was written for.
+	a, b := vault.Files[0], vault.Files[1]
+	if _, err := openMetadata(key, a.Index, a.Name, a.Meta); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		ad   []byte
+	}{
+		{"another index", metadataAD(b.Index, a.Name)},
+		{"another name", metadataAD(a.Index, b.Name)},
+		{"index only", legacyMetadataAD(a.Index)},
+	} {
+		if _, err := decodeMetadata(key, a.Meta, test.ad); err == nil {
+			t.Errorf("opened with %s", test.name)
+		}
+	}
+
+	// So b cannot take over a's metadata and note.
+	vault.Files[1].Meta = a.Meta
+	vault.cache.clear()
+	if meta, err := vault.Metadata("b.txt", key); err == nil {
+		t.Errorf("b.txt has a's metadata: %+v", meta)
+	}
+}
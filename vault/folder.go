@@ -0,0 +1,322 @@
+package vault
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry names are slash-separated paths relative to the vault root, such
+// as "projects/acme/report.pdf". A folder exists while something is stored
+// under it; folders created with Mkdir are also kept in Dirs, with their
+// names encrypted like entry names, so they can be empty.
+
+// cleanPath returns the canonical form of an entry or folder path.
+func cleanPath(name string) (string, error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "" {
+		return "", fmt.Errorf("invalid path: %q", name)
+	}
+	return cleaned, nil
+}
+
+// parentDirs returns every folder above name, outermost first.
+func parentDirs(name string) []string {
+	var dirs []string
+	for i, c := range name {
+		if c == '/' {
+			dirs = append(dirs, name[:i])
+		}
+	}
+	return dirs
+}
+
+// isUnder reports whether name is dir itself or inside it.
+func isUnder(name, dir string) bool {
+	return name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+// paths decrypts the names of every file and folder in the vault. Folders
+// include those that only exist because something is stored in them. The
+// caller must hold vault.mu.
+func (vault *Vault) paths(key []byte) (map[string]bool, map[string]bool, error) {
+	files := make(map[string]bool, len(vault.Files))
+	dirs := make(map[string]bool)
+	for _, file := range vault.Files {
+		fileName, err := vault.decryptName(key, file.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decrypt filename: %v", err)
+		}
+		files[fileName] = true
+		for _, dir := range parentDirs(fileName) {
+			dirs[dir] = true
+		}
+	}
+	for _, encryptedDir := range vault.Dirs {
+		dir, err := vault.decryptName(key, encryptedDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decrypt folder name: %v", err)
+		}
+		dirs[dir] = true
+		for _, parent := range parentDirs(dir) {
+			dirs[parent] = true
+		}
+	}
+	return files, dirs, nil
+}
+
+// checkNewPath returns an error if name cannot be created because it or
+// one of its parents is already taken.
+func checkNewPath(name string, files, dirs map[string]bool) error {
+	if files[name] {
+		return fmt.Errorf("file already exists")
+	}
+	if dirs[name] {
+		return fmt.Errorf("folder already exists")
+	}
+	for _, dir := range parentDirs(name) {
+		if files[dir] {
+			return fmt.Errorf("%s is a file", dir)
+		}
+	}
+	return nil
+}
+
+// ListDirs returns every folder in the vault, sorted.
+func (vault *Vault) ListDirs(key []byte) ([]string, error) {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+
+	_, dirs, err := vault.paths(key)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		list = append(list, dir)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// Mkdir creates an empty folder. Missing parent folders are created too.
+func (vault *Vault) Mkdir(dirPath string, key []byte) error {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
+
+	dirPath, err := cleanPath(dirPath)
+	if err != nil {
+		return err
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	files, dirs, err := vault.paths(key)
+	if err != nil {
+		return err
+	}
+	if err := checkNewPath(dirPath, files, dirs); err != nil {
+		return err
+	}
+
+	encryptedDir, err := EncryptFileName(key, dirPath)
+	if err != nil {
+		return err
+	}
+	vault.Dirs = append(vault.Dirs, encryptedDir)
+	return nil
+}
+
+// RemoveDir removes a folder and moves everything stored in it to the
+// trash. Each trashed entry remembers the empty folders removed with it,
+// so restoring the entries brings back the whole folder.
+func (vault *Vault) RemoveDir(dirPath string, key []byte) error {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
+
+	dirPath, err := cleanPath(dirPath)
+	if err != nil {
+		return err
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	_, dirs, err := vault.paths(key)
+	if err != nil {
+		return err
+	}
+	if !dirs[dirPath] {
+		return fmt.Errorf("folder not found: %s", dirPath)
+	}
+
+	var kept, removed []string
+	for _, encryptedDir := range vault.Dirs {
+		dir, err := vault.decryptName(key, encryptedDir)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt folder name: %v", err)
+		}
+		if isUnder(dir, dirPath) {
+			removed = append(removed, encryptedDir)
+		} else {
+			kept = append(kept, encryptedDir)
+		}
+	}
+
+	var files []FileEntry
+	deleted := time.Now()
+	for _, file := range vault.Files {
+		fileName, err := vault.decryptName(key, file.Name)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt filename: %v", err)
+		}
+		if isUnder(fileName, dirPath) {
+			vault.Trash = append(vault.Trash, TrashEntry{FileEntry: file, Deleted: deleted, Dirs: removed})
+			continue
+		}
+		files = append(files, file)
+	}
+
+	vault.Files = files
+	vault.Dirs = kept
+	return nil
+}
+
+// Rename gives a file or folder a new path. Renaming a folder moves
+// everything in it. Only names and metadata are re-encrypted; bodies are
+// left as they are.
+func (vault *Vault) Rename(oldPath, newPath string, key []byte) error {
+	return vault.rename(oldPath, newPath, key, true)
+}
+
+// RenameFile gives the entry named oldPath a new path, keeping its body
+// and history. Unlike Rename it refuses to rename folders.
+func (vault *Vault) RenameFile(oldPath, newPath string, key []byte) error {
+	return vault.rename(oldPath, newPath, key, false)
+}
+
+func (vault *Vault) rename(oldPath, newPath string, key []byte, dirsToo bool) error {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
+
+	oldPath, err := cleanPath(oldPath)
+	if err != nil {
+		return err
+	}
+	newPath, err = cleanPath(newPath)
+	if err != nil {
+		return err
+	}
+	if oldPath == newPath {
+		return nil
+	}
+	if isUnder(newPath, oldPath) {
+		return fmt.Errorf("cannot move %s into itself", oldPath)
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	files, dirs, err := vault.paths(key)
+	if err != nil {
+		return err
+	}
+	if !files[oldPath] && (!dirsToo || !dirs[oldPath]) {
+		return fmt.Errorf("file not found: %s", oldPath)
+	}
+	if err := checkNewPath(newPath, files, dirs); err != nil {
+		return err
+	}
+
+	renamed := make([]FileEntry, len(vault.Files))
+	for i, file := range vault.Files {
+		fileName, err := vault.decryptName(key, file.Name)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt filename: %v", err)
+		}
+		if !isUnder(fileName, oldPath) {
+			renamed[i] = file
+			continue
+		}
+
+		if renamed[i], err = renameEntry(key, file, newPath+strings.TrimPrefix(fileName, oldPath)); err != nil {
+			return err
+		}
+	}
+
+	renamedDirs := make([]string, len(vault.Dirs))
+	for i, encryptedDir := range vault.Dirs {
+		dir, err := vault.decryptName(key, encryptedDir)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt folder name: %v", err)
+		}
+		if !isUnder(dir, oldPath) {
+			renamedDirs[i] = encryptedDir
+			continue
+		}
+		renamedDirs[i], err = EncryptFileName(key, newPath+strings.TrimPrefix(dir, oldPath))
+		if err != nil {
+			return err
+		}
+	}
+
+	vault.Files = renamed
+	vault.Dirs = renamedDirs
+	return nil
+}
+
+// Move moves a file or folder into destDir, keeping its name. An empty
+// destDir is the vault root.
+func (vault *Vault) Move(srcPath, destDir string, key []byte) error {
+	srcPath, err := cleanPath(srcPath)
+	if err != nil {
+		return err
+	}
+	if destDir == "" || destDir == "/" {
+		return vault.Rename(srcPath, path.Base(srcPath), key)
+	}
+	return vault.Rename(srcPath, path.Join(destDir, path.Base(srcPath)), key)
+}
+
+// renameEntry encrypts newName for file and reseals the metadata of its
+// current body and versions, which is bound to the encrypted name.
+func renameEntry(key []byte, file FileEntry, newName string) (FileEntry, error) {
+	encryptedFileName, err := EncryptFileName(key, newName)
+	if err != nil {
+		return FileEntry{}, err
+	}
+
+	reseal := func(sealed []byte) ([]byte, error) {
+		meta, err := openMetadata(key, file.Index, file.Name, sealed)
+		if err != nil {
+			return nil, err
+		}
+		sealed, err = sealMetadata(key, file.Index, encryptedFileName, meta)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt metadata: %v", err)
+		}
+		return sealed, nil
+	}
+
+	entry := file
+	entry.Name = encryptedFileName
+	if entry.Meta, err = reseal(file.Meta); err != nil {
+		return FileEntry{}, err
+	}
+	entry.Versions = make([]Version, len(file.Versions))
+	for n, version := range file.Versions {
+		entry.Versions[n] = version
+		if entry.Versions[n].Meta, err = reseal(version.Meta); err != nil {
+			return FileEntry{}, err
+		}
+	}
+	return entry, nil
+}
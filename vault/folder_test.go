@@ -0,0 +1,183 @@
+package vault
+
+import (
+	"slices"
+	"sort"
+	"testing"
+)
+
+// listNames returns the sorted names of every entry and every folder in
+// the vault.
+func listNames(t *testing.T, vault *Vault, key []byte) ([]string, []string) {
+	t.Helper()
+	files, err := vault.List(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	dirs, err := vault.ListDirs(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names, dirs
+}
+
+// addFiles adds an entry holding its own name for each of names.
+func addFiles(t *testing.T, vault *Vault, key []byte, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := vault.AddFile(name, []byte(name), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMkdir(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+	addFiles(t, vault, key, "docs/a.txt")
+
+	if err := vault.Mkdir("projects/acme/2024", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Mkdir("docs/empty", key); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"docs", "docs/empty", "projects", "projects/acme", "projects/acme/2024"}
+	if _, dirs := listNames(t, vault, key); !slices.Equal(dirs, want) {
+		t.Errorf("folders %v, want %v", dirs, want)
+	}
+
+	for _, dir := range []string{"projects/acme", "docs", "docs/a.txt", "docs/a.txt/sub", "", "/"} {
+		if err := vault.Mkdir(dir, key); err == nil {
+			t.Errorf("created %q", dir)
+		}
+	}
+
+	// Empty folders are kept across a save.
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+	reopened, key, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if _, dirs := listNames(t, reopened, key); !slices.Equal(dirs, want) {
+		t.Errorf("folders after reopening %v, want %v", dirs, want)
+	}
+}
+
+func TestRename(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	addFiles(t, vault, key, "docs/a.txt", "docs/sub/b.txt", "docs2/c.txt", "top.txt")
+	if err := vault.Mkdir("docs/sub/empty", key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vault.Rename("docs", "archive/old", key); err != nil {
+		t.Fatal(err)
+	}
+	names, dirs := listNames(t, vault, key)
+	if want := []string{"archive/old/a.txt", "archive/old/sub/b.txt", "docs2/c.txt", "top.txt"}; !slices.Equal(names, want) {
+		t.Errorf("entries %v, want %v", names, want)
+	}
+	if want := []string{"archive", "archive/old", "archive/old/sub", "archive/old/sub/empty", "docs2"}; !slices.Equal(dirs, want) {
+		t.Errorf("folders %v, want %v", dirs, want)
+	}
+	// Only the name changed: the body is still there, and its metadata
+	// follows the new name.
+	if data, err := readEntry(vault, "archive/old/sub/b.txt", key); err != nil || data != "docs/sub/b.txt" {
+		t.Errorf("archive/old/sub/b.txt holds %q, %v", data, err)
+	}
+
+	for _, test := range []struct{ from, to string }{
+		{"top.txt", "docs2/c.txt"},        // onto a file
+		{"top.txt", "archive"},            // onto a folder
+		{"top.txt", "docs2/c.txt/x"},      // under a file
+		{"archive", "archive/old/sub/in"}, // into its own subtree
+		{"missing.txt", "other.txt"},
+	} {
+		if err := vault.Rename(test.from, test.to, key); err == nil {
+			t.Errorf("renamed %s to %s", test.from, test.to)
+		}
+	}
+	if names, _ := listNames(t, vault, key); len(names) != 4 {
+		t.Errorf("failed renames changed the entries: %v", names)
+	}
+
+	if err := vault.RenameFile("archive", "other", key); err == nil {
+		t.Error("RenameFile renamed a folder")
+	}
+	if err := vault.RenameFile("top.txt", "docs2/top.txt", key); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readEntry(vault, "docs2/top.txt", key); err != nil || data != "top.txt" {
+		t.Errorf("docs2/top.txt holds %q, %v", data, err)
+	}
+}
+
+func TestMove(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	addFiles(t, vault, key, "a.txt", "docs/b.txt", "docs/sub/c.txt", "other/b.txt")
+
+	if err := vault.Move("a.txt", "docs/sub", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Move("docs/sub", "other", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Move("other/sub/c.txt", "", key); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := listNames(t, vault, key)
+	if want := []string{"c.txt", "docs/b.txt", "other/b.txt", "other/sub/a.txt"}; !slices.Equal(names, want) {
+		t.Errorf("entries %v, want %v", names, want)
+	}
+
+	if err := vault.Move("docs/b.txt", "other", key); err == nil {
+		t.Error("moved onto an existing entry")
+	}
+	if err := vault.Move("other", "other/sub", key); err == nil {
+		t.Error("moved a folder into itself")
+	}
+	if data, err := readEntry(vault, "other/sub/a.txt", key); err != nil || data != "a.txt" {
+		t.Errorf("other/sub/a.txt holds %q, %v", data, err)
+	}
+}
+
+func TestRemoveDir(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	addFiles(t, vault, key, "docs/a.txt", "docs/sub/b.txt", "docs2/c.txt")
+	if err := vault.Mkdir("docs/sub/empty", key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vault.RemoveDir("docs/missing", key); err == nil {
+		t.Error("removed a missing folder")
+	}
+	if err := vault.RemoveDir("docs2/c.txt", key); err == nil {
+		t.Error("removed a file as a folder")
+	}
+
+	// A folder that is not empty goes to the trash with everything in it,
+	// leaving folders that only share its prefix alone.
+	if err := vault.RemoveDir("docs", key); err != nil {
+		t.Fatal(err)
+	}
+	names, dirs := listNames(t, vault, key)
+	if !slices.Equal(names, []string{"docs2/c.txt"}) || !slices.Equal(dirs, []string{"docs2"}) {
+		t.Errorf("left entries %v and folders %v", names, dirs)
+	}
+	trash, err := vault.ListTrash(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 2 {
+		t.Errorf("%d entries in the trash, want 2", len(trash))
+	}
+}
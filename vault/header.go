@@ -0,0 +1,120 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A vault file starts with vaultMagic and a big-endian uint16 format
+// version, followed by the gob-encoded Header and then the gob-encoded
+// Vault. Files written before the header existed are a bare gob-encoded
+// Vault and are still read.
+var vaultMagic = []byte("SFVAULT\x00")
+
+// FormatVersion is the version written by Save. Version 1 stored a hash of
+// the password-derived key instead of a wrapped master key, version 2
+// kept every file body inline, and version 3 sealed each blob to its entry
+// so identical bodies could not be shared.
+const FormatVersion = 4
+
+var ErrUnsupportedVersion = errors.New("unsupported vault format version")
+
+// Header describes how the rest of the vault file is protected. The
+// master key that encrypts entries is stored in WrappedKey, sealed under a
+// key derived from the password with KDF. KeyHash is only set in vaults
+// written before the master key existed.
+type Header struct {
+	KDF        KDFParams
+	Cipher     string
+	WrappedKey []byte
+	KeyHash    string
+}
+
+// legacyVault is the layout of vault files written before the header.
+type legacyVault struct {
+	Salt      string
+	KeyHash   string
+	Cipher    string
+	NextIndex uint64
+	Files     []FileEntry
+}
+
+func (vault *Vault) encode(w io.Writer) error {
+	var version [2]byte
+	binary.BigEndian.PutUint16(version[:], FormatVersion)
+
+	if _, err := w.Write(vaultMagic); err != nil {
+		return err
+	}
+	if _, err := w.Write(version[:]); err != nil {
+		return err
+	}
+
+	encoder := gob.NewEncoder(w)
+	if err := encoder.Encode(vault.header); err != nil {
+		return err
+	}
+	return encoder.Encode(vault)
+}
+
+func decodeVault(r io.Reader) (*Vault, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(vaultMagic))
+	if err != nil || !bytes.Equal(magic, vaultMagic) {
+		return decodeLegacyVault(br)
+	}
+	br.Discard(len(vaultMagic))
+
+	var version [2]byte
+	if _, err := io.ReadFull(br, version[:]); err != nil {
+		return nil, err
+	}
+	v := binary.BigEndian.Uint16(version[:])
+	if v < 1 || v > FormatVersion {
+		return nil, fmt.Errorf("%w %d (this build reads up to version %d)", ErrUnsupportedVersion, v, FormatVersion)
+	}
+
+	var vault Vault
+	decoder := gob.NewDecoder(br)
+	if err := decoder.Decode(&vault.header); err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(&vault); err != nil {
+		return nil, err
+	}
+	vault.formatVersion = v
+	return &vault, nil
+}
+
+func decodeLegacyVault(r io.Reader) (*Vault, error) {
+	var legacy legacyVault
+	if err := gob.NewDecoder(r).Decode(&legacy); err != nil {
+		return nil, err
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(legacy.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher := legacy.Cipher
+	if cipher == "" {
+		cipher = CipherAESCBC
+	}
+
+	return &Vault{
+		header: Header{
+			KDF:     legacyKDFParams(salt),
+			Cipher:  cipher,
+			KeyHash: legacy.KeyHash,
+		},
+		NextIndex: legacy.NextIndex,
+		Files:     legacy.Files,
+	}, nil
+}
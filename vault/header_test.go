@@ -0,0 +1,112 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// headerBytes returns the start of a vault file with the given magic and
+// format version.
+func headerBytes(magic []byte, version uint16) []byte {
+	return binary.BigEndian.AppendUint16(bytes.Clone(magic), version)
+}
+
+func TestDecodeVault(t *testing.T) {
+	vault, _, vaultPath := newTestVault(t)
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	current, err := os.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := current[len(vaultMagic)+2:]
+	legacy, err := os.ReadFile(filepath.Join("testdata", "legacy-cbc.vault"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		data        []byte
+		unsupported bool
+		cipher      string
+		version     uint16
+	}{
+		{name: "current", data: current, cipher: CipherAESGCM, version: FormatVersion},
+		{name: "older version", data: append(headerBytes(vaultMagic, 1), body...), cipher: CipherAESGCM, version: 1},
+		{name: "pre-header", data: legacy, cipher: CipherAESCBC},
+		{name: "version 0", data: append(headerBytes(vaultMagic, 0), body...), unsupported: true},
+		{name: "newer version", data: append(headerBytes(vaultMagic, FormatVersion+1), body...), unsupported: true},
+		{name: "bad magic", data: append(headerBytes([]byte("SFVAULX\x00"), FormatVersion), body...)},
+		{name: "no version", data: bytes.Clone(vaultMagic)},
+		{name: "truncated", data: current[:len(current)/2]},
+		{name: "empty", data: nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := decodeVault(bytes.NewReader(test.data))
+			if test.cipher == "" {
+				if err == nil {
+					t.Fatal("decoded")
+				}
+				if got := errors.Is(err, ErrUnsupportedVersion); got != test.unsupported {
+					t.Errorf("error %v, unsupported version %v, want %v", err, got, test.unsupported)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.header.Cipher != test.cipher || decoded.formatVersion != test.version {
+				t.Errorf("cipher %q, version %d; want %q, %d", decoded.header.Cipher, decoded.formatVersion, test.cipher, test.version)
+			}
+		})
+	}
+}
+
+func TestDecodeLegacyVault(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "legacy-cbc.vault"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault, err := decodeVault(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kdf := vault.header.KDF
+	if kdf.Algorithm != KDFScrypt || kdf.N != 16384 || len(kdf.Salt) != 16 {
+		t.Errorf("legacy key derivation %+v", kdf)
+	}
+	if vault.header.KeyHash == "" || len(vault.header.WrappedKey) != 0 {
+		t.Errorf("legacy header %+v", vault.header)
+	}
+	if len(vault.Files) != 3 {
+		t.Errorf("%d entries, want 3", len(vault.Files))
+	}
+}
+
+func TestReadVaultFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, test := range map[string]struct {
+		data []byte
+		want error
+	}{
+		"newer": {headerBytes(vaultMagic, FormatVersion+1), ErrUnsupportedVersion},
+		"junk":  {[]byte("not a vault"), ErrVaultCorrupted},
+	} {
+		vaultPath := filepath.Join(dir, name)
+		if err := os.WriteFile(vaultPath, test.data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readVaultFile(vaultPath); !errors.Is(err, test.want) {
+			t.Errorf("%s: %v, want %v", name, err, test.want)
+		}
+		if _, _, err := OpenVault(vaultPath, testPassword); !errors.Is(err, test.want) {
+			t.Errorf("%s: OpenVault returned %v, want %v", name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package vault
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KDFScrypt   = "scrypt"
+	KDFArgon2id = "argon2id"
+)
+
+// DefaultKDFTarget is how long deriving the key of a new vault should take.
+const DefaultKDFTarget = 500 * time.Millisecond
+
+const (
+	argon2Memory    = 64 * 1024
+	argon2MinMemory = 16 * 1024
+	argon2MaxTime   = 16
+)
+
+// kdfMaxMemory limits the memory, in KiB, that deriving a key may take. The
+// parameters are read from the vault or bundle being opened, so a crafted
+// file could otherwise make unlocking it take all memory.
+const kdfMaxMemory = 1024 * 1024
+
+// KDFParams records how a vault key is derived from its password. N, R and
+// P are used by scrypt; Memory (in KiB), Time and Threads by Argon2id.
+type KDFParams struct {
+	Algorithm string
+	Salt      []byte
+	N         int
+	R         int
+	P         int
+	Memory    uint32
+	Time      uint32
+	Threads   uint8
+}
+
+// NewKDFParams returns Argon2id parameters for a new vault, calibrated to
+// DefaultKDFTarget on this machine, with a fresh salt.
+func NewKDFParams() (KDFParams, error) {
+	return CalibrateKDF(DefaultKDFTarget)
+}
+
+// CalibrateKDF picks Argon2id parameters that take roughly target to derive
+// a key on this machine. It starts from 64 MiB and one pass, lowers memory
+// if even that is too slow, and otherwise raises the number of passes.
+func CalibrateKDF(target time.Duration) (KDFParams, error) {
+	salt, err := GenerateSalt()
+	if err != nil {
+		return KDFParams{}, err
+	}
+
+	threads := runtime.NumCPU()
+	if threads > 4 {
+		threads = 4
+	}
+
+	params := KDFParams{
+		Algorithm: KDFArgon2id,
+		Salt:      salt,
+		Memory:    argon2Memory,
+		Time:      1,
+		Threads:   uint8(threads),
+	}
+
+	elapsed := timeKDF(params)
+	for elapsed > target && params.Memory > argon2MinMemory {
+		params.Memory /= 2
+		elapsed = timeKDF(params)
+	}
+
+	if elapsed > 0 && elapsed < target {
+		passes := uint32((target + elapsed - 1) / elapsed)
+		if passes > argon2MaxTime {
+			passes = argon2MaxTime
+		}
+		params.Time = passes
+	}
+	return params, nil
+}
+
+func timeKDF(params KDFParams) time.Duration {
+	start := time.Now()
+	argon2.IDKey([]byte("calibration"), params.Salt, params.Time, params.Memory, params.Threads, 32)
+	return time.Since(start)
+}
+
+// legacyKDFParams are the scrypt parameters every vault used before they
+// were recorded in the header.
+func legacyKDFParams(salt []byte) KDFParams {
+	return KDFParams{
+		Algorithm: KDFScrypt,
+		Salt:      salt,
+		N:         16384,
+		R:         8,
+		P:         1,
+	}
+}
+
+func DeriveKey(password string, params KDFParams) ([]byte, error) {
+	if err := checkKDFParams(params); err != nil {
+		return nil, err
+	}
+	switch params.Algorithm {
+	case KDFScrypt:
+		return scrypt.Key([]byte(password), params.Salt, params.N, params.R, params.P, 32)
+	default:
+		return argon2.IDKey([]byte(password), params.Salt, params.Time, params.Memory, params.Threads, 32), nil
+	}
+}
+
+// checkKDFParams refuses parameters that are invalid or would take more
+// than kdfMaxMemory or argon2MaxTime passes to derive a key with.
+func checkKDFParams(params KDFParams) error {
+	switch params.Algorithm {
+	case KDFScrypt:
+		if params.N < 2 || params.N&(params.N-1) != 0 || params.R < 1 || params.P < 1 {
+			return fmt.Errorf("invalid scrypt parameters")
+		}
+		// scrypt needs 128*N*R bytes, and P times the work.
+		if uint64(params.N)*uint64(params.R) > kdfMaxMemory*1024/128 || params.P > argon2MaxTime {
+			return fmt.Errorf("scrypt parameters exceed the supported limits")
+		}
+	case KDFArgon2id:
+		if params.Time == 0 || params.Memory == 0 || params.Threads == 0 {
+			return fmt.Errorf("invalid argon2id parameters")
+		}
+		if params.Memory > kdfMaxMemory || params.Time > argon2MaxTime {
+			return fmt.Errorf("argon2id parameters exceed the supported limits")
+		}
+	default:
+		return fmt.Errorf("unsupported key derivation function %q", params.Algorithm)
+	}
+	return nil
+}
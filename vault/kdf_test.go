@@ -0,0 +1,159 @@
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckKDFParams(t *testing.T) {
+	argon := KDFParams{Algorithm: KDFArgon2id, Salt: make([]byte, 16), Memory: argon2Memory, Time: 1, Threads: 1}
+	legacy := legacyKDFParams(make([]byte, 16))
+
+	for _, test := range []struct {
+		name   string
+		params KDFParams
+		change func(*KDFParams)
+		ok     bool
+	}{
+		{name: "argon2id", params: argon, change: func(*KDFParams) {}, ok: true},
+		{name: "argon2id at the limits", params: argon, change: func(p *KDFParams) { p.Memory, p.Time = kdfMaxMemory, argon2MaxTime }, ok: true},
+		{name: "argon2id memory", params: argon, change: func(p *KDFParams) { p.Memory = kdfMaxMemory + 1 }},
+		{name: "argon2id passes", params: argon, change: func(p *KDFParams) { p.Time = argon2MaxTime + 1 }},
+		{name: "argon2id no memory", params: argon, change: func(p *KDFParams) { p.Memory = 0 }},
+		{name: "argon2id no threads", params: argon, change: func(p *KDFParams) { p.Threads = 0 }},
+		{name: "legacy scrypt", params: legacy, change: func(*KDFParams) {}, ok: true},
+		{name: "scrypt memory", params: legacy, change: func(p *KDFParams) { p.N = 1 << 24 }},
+		{name: "scrypt block size", params: legacy, change: func(p *KDFParams) { p.R = 1 << 20 }},
+		{name: "scrypt parallelism", params: legacy, change: func(p *KDFParams) { p.P = 1 << 20 }},
+		{name: "scrypt N not a power of two", params: legacy, change: func(p *KDFParams) { p.N = 10000 }},
+		{name: "scrypt negative", params: legacy, change: func(p *KDFParams) { p.R = -1 }},
+		{name: "unknown", params: argon, change: func(p *KDFParams) { p.Algorithm = "pbkdf2" }},
+	} {
+		params := test.params
+		test.change(&params)
+		if err := checkKDFParams(params); (err == nil) != test.ok {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
+
+// setKDF rewraps the master key of the vault at vaultPath under kdf and
+// saves it, as a vault written with those parameters would be.
+func setKDF(t *testing.T, vault *Vault, vaultPath string, key []byte, kdf KDFParams) {
+	t.Helper()
+	kek, err := DeriveKey(testPassword, kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := EncryptData(kek, key, masterKeyAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault.header.KDF = kdf
+	vault.header.WrappedKey = wrapped
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+}
+
+func TestOpenVaultKDFLimits(t *testing.T) {
+	vault, _, vaultPath := newTestVault(t)
+	vault.Close()
+
+	// A header demanding more memory than allowed is refused before any
+	// key is derived.
+	saved, err := readVaultFile(vaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved.header.KDF.Memory = 64 * kdfMaxMemory
+	if err := saved.writeVaultFile(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenVault(vaultPath, testPassword); err == nil || !strings.Contains(err.Error(), "limits") {
+		t.Errorf("opening a vault with %d KiB key derivation returned %v", saved.header.KDF.Memory, err)
+	}
+	if _, _, err := OpenVaultReadOnly(vaultPath, testPassword); err == nil {
+		t.Error("opened read-only")
+	}
+}
+
+func TestUnlockRewrapsScrypt(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+	if err := vault.AddFile("a.txt", []byte("a"), key); err != nil {
+		t.Fatal(err)
+	}
+	blob := vault.Files[0].Blob
+	setKDF(t, vault, vaultPath, key, legacyKDFParams(vault.header.KDF.Salt))
+
+	// Read-only, the scrypt key is used as it is.
+	readOnly, readOnlyKey, err := OpenVaultReadOnly(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readOnly.header.KDF.Algorithm != KDFScrypt {
+		t.Errorf("read-only open changed the key derivation to %s", readOnly.header.KDF.Algorithm)
+	}
+	if data, err := readEntry(readOnly, "a.txt", readOnlyKey); err != nil || data != "a" {
+		t.Errorf("a.txt holds %q, %v", data, err)
+	}
+
+	reopened, reopenedKey, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+	saved, err := readVaultFile(vaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kdf := saved.header.KDF; kdf.Algorithm != KDFArgon2id || kdf.Memory == 0 {
+		t.Errorf("saved key derivation %+v, want argon2id", kdf)
+	}
+	// Only the master key was rewrapped: it and the bodies are unchanged.
+	if string(reopenedKey) != string(key) || saved.Files[0].Blob != blob {
+		t.Error("the master key or the body changed")
+	}
+
+	final, finalKey, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer final.Close()
+	if data, err := readEntry(final, "a.txt", finalKey); err != nil || data != "a" {
+		t.Errorf("a.txt holds %q, %v after the upgrade", data, err)
+	}
+}
+
+func TestOpenVaultUpgradeSaveFails(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+	setKDF(t, vault, vaultPath, key, legacyKDFParams(vault.header.KDF.Salt))
+
+	// Rotating the backups fails when the oldest one cannot be replaced.
+	oldest := backupPath(vaultPath, BackupCount)
+	if err := os.MkdirAll(filepath.Join(oldest, "keep"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(backupPath(vaultPath, BackupCount-1), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenVault(vaultPath, testPassword); err == nil || !strings.Contains(err.Error(), "upgraded") {
+		t.Fatalf("opening with a failing save returned %v", err)
+	}
+
+	// The vault was left as it was, and unlocked.
+	if err := os.RemoveAll(oldest); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := readVaultFile(vaultPath); err != nil || saved.header.KDF.Algorithm != KDFScrypt {
+		t.Fatalf("vault after the failed upgrade: %v", err)
+	}
+	reopened, _, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+}
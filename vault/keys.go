@@ -0,0 +1,91 @@
+package vault
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+)
+
+// masterKeyAD is the associated data the master key is wrapped with.
+var masterKeyAD = []byte("secure-file-vault master key")
+
+// newMasterKey returns a random 256-bit key that encrypts every entry of a
+// vault. It never leaves the process unwrapped.
+func newMasterKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// unlock derives the key-encryption key from password and unwraps the
+// master key with it. Vaults written before the master key existed have no
+// wrapped key; for those the derived key itself is returned once it matches
+// the stored hash.
+func (header Header) unlock(password string) ([]byte, error) {
+	kek, err := DeriveKey(password, header.KDF)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(header.WrappedKey) == 0 {
+		keyHash := sha256.Sum256(kek)
+		storedHash, err := base64.StdEncoding.DecodeString(header.KeyHash)
+		if err != nil || subtle.ConstantTimeCompare(keyHash[:], storedHash) != 1 {
+			return nil, fmt.Errorf("invalid password")
+		}
+		return kek, nil
+	}
+
+	masterKey, err := DecryptData(kek, header.WrappedKey, masterKeyAD)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password")
+	}
+	return masterKey, nil
+}
+
+// wrapMasterKey derives a fresh key-encryption key from password with new
+// Argon2id parameters and stores masterKey wrapped under it.
+func (header *Header) wrapMasterKey(password string, masterKey []byte) error {
+	kdf, err := NewKDFParams()
+	if err != nil {
+		return err
+	}
+	kek, err := DeriveKey(password, kdf)
+	if err != nil {
+		return err
+	}
+
+	wrappedKey, err := EncryptData(kek, masterKey, masterKeyAD)
+	if err != nil {
+		return err
+	}
+
+	header.KDF = kdf
+	header.WrappedKey = wrappedKey
+	header.KeyHash = ""
+	return nil
+}
+
+// upgradeToMasterKey moves a vault whose entries are encrypted directly
+// under the password-derived key onto a random master key.
+func (vault *Vault) upgradeToMasterKey(password string, key []byte) ([]byte, error) {
+	masterKey, err := newMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := vault.rekey(key, masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := vault.header.wrapMasterKey(password, masterKey); err != nil {
+		return nil, err
+	}
+	vault.Files = files
+	return masterKey, nil
+}
@@ -0,0 +1,149 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestUnlockFails(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	header := vault.header
+
+	if got, err := header.unlock(testPassword); err != nil || !bytes.Equal(got, key) {
+		t.Fatalf("unlock returned %x, %v", got, err)
+	}
+	if _, err := header.unlock("wrong password"); err == nil {
+		t.Error("unlocked with the wrong password")
+	}
+
+	for _, i := range []int{0, len(header.WrappedKey) / 2, len(header.WrappedKey) - 1} {
+		corrupted := header
+		corrupted.WrappedKey = bytes.Clone(header.WrappedKey)
+		corrupted.WrappedKey[i] ^= 1
+		if _, err := corrupted.unlock(testPassword); err == nil {
+			t.Errorf("unlocked with byte %d of the wrapped key flipped", i)
+		}
+	}
+	truncated := header
+	truncated.WrappedKey = header.WrappedKey[:len(header.WrappedKey)-1]
+	if _, err := truncated.unlock(testPassword); err == nil {
+		t.Error("unlocked with a truncated wrapped key")
+	}
+}
+
+func TestUnlockKeyHash(t *testing.T) {
+	kdf := legacyKDFParams(make([]byte, 16))
+	kek, err := DeriveKey(testPassword, kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyHash := sha256.Sum256(kek)
+	header := Header{KDF: kdf, KeyHash: base64.StdEncoding.EncodeToString(keyHash[:])}
+
+	// Before the master key, the derived key itself encrypted the entries.
+	if got, err := header.unlock(testPassword); err != nil || !bytes.Equal(got, kek) {
+		t.Errorf("unlock returned %x, %v; want the derived key", got, err)
+	}
+	if _, err := header.unlock("wrong password"); err == nil {
+		t.Error("unlocked with the wrong password")
+	}
+	for _, keyHash := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(keyHash[:16])} {
+		header.KeyHash = keyHash
+		if _, err := header.unlock(testPassword); err == nil {
+			t.Errorf("unlocked with key hash %q", keyHash)
+		}
+	}
+}
+
+func TestUpgradeToMasterKey(t *testing.T) {
+	vaultPath := copyFixture(t, "legacy-cbc.vault")
+	legacy, err := readVaultFile(vaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek, err := legacy.header.unlock(legacyPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault, key, err := OpenVault(vaultPath, legacyPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Close()
+	if bytes.Equal(key, kek) {
+		t.Error("the entries are still encrypted under the password-derived key")
+	}
+	if vault.header.KeyHash != "" || len(vault.header.WrappedKey) == 0 {
+		t.Errorf("upgraded header %+v", vault.header)
+	}
+
+	// The master key is wrapped under a fresh key derived from the same
+	// password.
+	if bytes.Equal(vault.header.KDF.Salt, legacy.header.KDF.Salt) {
+		t.Error("the salt was reused")
+	}
+	if unwrapped, err := vault.header.unlock(legacyPassword); err != nil || !bytes.Equal(unwrapped, key) {
+		t.Errorf("unwrapping the master key returned %x, %v", unwrapped, err)
+	}
+	if data, err := readEntry(vault, "notes.txt", key); err != nil || data != "written before entries were authenticated\n" {
+		t.Errorf("notes.txt holds %q, %v", data, err)
+	}
+}
+
+func TestChangePasswordKeepsBodies(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := vault.AddFile(name, []byte("body of "+name), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	files := append([]FileEntry(nil), vault.Files...)
+	blobs := make(map[string][]byte)
+	for _, file := range files {
+		data, err := os.ReadFile(vault.blobPath(file.Blob))
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs[file.Blob] = data
+	}
+	oldHeader := vault.header
+
+	if err := vault.ChangePassword(vaultPath, testPassword, "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(vault.header.WrappedKey, oldHeader.WrappedKey) || bytes.Equal(vault.header.KDF.Salt, oldHeader.KDF.Salt) {
+		t.Error("the master key was not rewrapped under a new salt")
+	}
+	if !reflect.DeepEqual(vault.Files, files) {
+		t.Error("the entries changed")
+	}
+	for blob, data := range blobs {
+		if saved, err := os.ReadFile(vault.blobPath(blob)); err != nil || !bytes.Equal(saved, data) {
+			t.Errorf("blob %s was rewritten: %v", blob, err)
+		}
+	}
+	vault.Close()
+
+	if _, _, err := OpenVault(vaultPath, testPassword); err == nil {
+		t.Error("opened with the old password")
+	}
+	reopened, newKey, err := OpenVault(vaultPath, "new password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if !bytes.Equal(newKey, key) {
+		t.Error("the master key changed")
+	}
+	if data, err := readEntry(reopened, "b.txt", newKey); err != nil || data != "body of b.txt" {
+		t.Errorf("b.txt holds %q, %v", data, err)
+	}
+}
@@ -0,0 +1,83 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+)
+
+// LockInfo identifies the process holding a vault open for writing. It is
+// stored as JSON in the lock file next to the vault.
+type LockInfo struct {
+	PID   int       `json:"pid"`
+	Host  string    `json:"host"`
+	User  string    `json:"user"`
+	Since time.Time `json:"since"`
+}
+
+func (info LockInfo) String() string {
+	return fmt.Sprintf("%s@%s (pid %d) since %s", info.User, info.Host, info.PID, info.Since.Format(time.DateTime))
+}
+
+// LockedError is returned when another process holds the vault open for
+// writing. The vault can still be opened with OpenVaultReadOnly.
+type LockedError struct {
+	Holder LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("vault is in use by %s", e.Holder)
+}
+
+var ErrReadOnly = errors.New("vault is open read-only")
+
+var errLockHeld = errors.New("lock is held by another process")
+
+func lockPath(vaultPath string) string {
+	return vaultPath + ".lock"
+}
+
+func currentLockInfo() LockInfo {
+	info := LockInfo{PID: os.Getpid(), Since: time.Now()}
+	info.Host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		info.User = u.Username
+	}
+	return info
+}
+
+func readLockInfo(path string) (LockInfo, error) {
+	var info LockInfo
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// lockVault takes the write lock of vaultPath and records this process as
+// its holder.
+func lockVault(vaultPath string) (*fileLock, error) {
+	lock, err := acquireLock(lockPath(vaultPath))
+	if err == errLockHeld {
+		holder, _ := readLockInfo(lockPath(vaultPath))
+		return nil, &LockedError{Holder: holder}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock vault: %v", err)
+	}
+
+	data, err := json.Marshal(currentLockInfo())
+	if err == nil {
+		err = lock.write(data)
+	}
+	if err != nil {
+		lock.release()
+		return nil, fmt.Errorf("failed to lock vault: %v", err)
+	}
+	return lock, nil
+}
@@ -0,0 +1,96 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestOpenVaultWhileLocked(t *testing.T) {
+	vault, _, vaultPath := newTestVault(t)
+
+	_, _, err := OpenVault(vaultPath, testPassword)
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("second OpenVault returned %v, want a *LockedError", err)
+	}
+	if locked.Holder.PID != os.Getpid() {
+		t.Errorf("holder PID is %d, want %d", locked.Holder.PID, os.Getpid())
+	}
+	if _, _, _, err := OpenBackup(vaultPath, testPassword); !errors.As(err, &locked) {
+		t.Errorf("OpenBackup returned %v, want a *LockedError", err)
+	}
+
+	// Once closed, the vault can be opened again.
+	vault.Close()
+	reopened, _, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+}
+
+func TestOpenVaultReadOnly(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+	if err := vault.AddFile("a.txt", []byte("data"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+
+	readOnly, key, err := OpenVaultReadOnly(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	if !readOnly.ReadOnly() {
+		t.Error("ReadOnly() is false")
+	}
+	if data, err := readEntry(readOnly, "a.txt", key); err != nil || data != "data" {
+		t.Errorf("reading a read-only vault: %q, %v", data, err)
+	}
+
+	for name, err := range map[string]error{
+		"AddFile":    readOnly.AddFile("b.txt", []byte("data"), key),
+		"UpdateFile": readOnly.UpdateFile("a.txt", key, []byte("changed")),
+		"RemoveFile": readOnly.RemoveFile("a.txt", key),
+		"Mkdir":      readOnly.Mkdir("dir", key),
+		"Save":       readOnly.Save(vaultPath),
+	} {
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s returned %v, want ErrReadOnly", name, err)
+		}
+	}
+
+	// The writer still holds the lock.
+	if err := vault.AddFile("b.txt", []byte("data"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleLockIsTakenOver(t *testing.T) {
+	vault, _, vaultPath := newTestVault(t)
+	vault.Close()
+
+	// A lock file left behind by a process that no longer runs.
+	holder := currentLockInfo()
+	holder.PID = 1 << 30
+	data, err := json.Marshal(holder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lockPath(vaultPath), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, _, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatalf("stale lock was not taken over: %v", err)
+	}
+	reopened.Close()
+}
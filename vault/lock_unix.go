@@ -0,0 +1,45 @@
+//go:build !windows
+
+package vault
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileLock is an flock(2) lock on the lock file. The kernel drops it when
+// the holding process exits, so a lock file left behind by a crash is
+// simply taken over.
+type fileLock struct {
+	file *os.File
+}
+
+func acquireLock(path string) (*fileLock, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errLockHeld
+		}
+		return nil, err
+	}
+	return &fileLock{file: file}, nil
+}
+
+func (lock *fileLock) write(data []byte) error {
+	if err := lock.file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := lock.file.WriteAt(data, 0)
+	return err
+}
+
+func (lock *fileLock) release() error {
+	lock.file.Truncate(0)
+	syscall.Flock(int(lock.file.Fd()), syscall.LOCK_UN)
+	return lock.file.Close()
+}
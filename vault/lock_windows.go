@@ -0,0 +1,62 @@
+//go:build windows
+
+package vault
+
+import (
+	"os"
+	"time"
+)
+
+// fileLock is a lock file created exclusively. A lock file whose holder
+// ran on this host and is no longer running is stale and is replaced.
+type fileLock struct {
+	file *os.File
+	path string
+}
+
+func acquireLock(path string) (*fileLock, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) && isStaleLock(path) {
+		os.Remove(path)
+		file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	}
+	if os.IsExist(err) {
+		return nil, errLockHeld
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fileLock{file: file, path: path}, nil
+}
+
+func isStaleLock(path string) bool {
+	holder, err := readLockInfo(path)
+	if err != nil {
+		// The holder may not have written its details yet, so only a lock
+		// file that has stayed unreadable for a while is abandoned.
+		info, statErr := os.Stat(path)
+		return statErr == nil && time.Since(info.ModTime()) > time.Minute
+	}
+
+	host, _ := os.Hostname()
+	if holder.Host != host {
+		return false
+	}
+
+	process, err := os.FindProcess(holder.PID)
+	if err != nil {
+		return true
+	}
+	process.Release()
+	return false
+}
+
+func (lock *fileLock) write(data []byte) error {
+	_, err := lock.file.WriteAt(data, 0)
+	return err
+}
+
+func (lock *fileLock) release() error {
+	lock.file.Close()
+	return os.Remove(lock.path)
+}
@@ -0,0 +1,79 @@
+package vault
+
+import "time"
+
+// DefaultVersionsToKeep is how many earlier versions of each entry are
+// kept when Settings.VersionsToKeep is zero.
+const DefaultVersionsToKeep = 10
+
+// Settings are per-vault options. They are stored unencrypted in the vault
+// file.
+type Settings struct {
+	// VersionsToKeep is how many earlier versions of each entry are kept
+	// when it is updated. Zero keeps DefaultVersionsToKeep; a negative
+	// value keeps none.
+	VersionsToKeep int
+	// VersionMaxAge, if set, also drops versions older than this.
+	VersionMaxAge time.Duration
+	// TrashMaxAge, if set, purges entries that have been in the trash for
+	// longer than this when the vault is opened. Otherwise the trash is
+	// kept until it is emptied.
+	TrashMaxAge time.Duration
+	// Compression is the codec new and updated bodies are compressed with,
+	// unless their type is already compressed. CodecNone stores them as
+	// they are.
+	Compression string
+	// OpenTimeout is how long a file opened temporarily in a Workspace may
+	// go unchanged before it is closed. Zero uses DefaultOpenTimeout.
+	OpenTimeout time.Duration
+}
+
+// OpenTimeoutOrDefault returns OpenTimeout, or DefaultOpenTimeout if it is
+// not set.
+func (settings Settings) OpenTimeoutOrDefault() time.Duration {
+	if settings.OpenTimeout <= 0 {
+		return DefaultOpenTimeout
+	}
+	return settings.OpenTimeout
+}
+
+func (settings Settings) versionsToKeep() int {
+	switch {
+	case settings.VersionsToKeep == 0:
+		return DefaultVersionsToKeep
+	case settings.VersionsToKeep < 0:
+		return 0
+	}
+	return settings.VersionsToKeep
+}
+
+func (vault *Vault) Settings() Settings {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+	return vault.Options
+}
+
+// SetSettings changes the vault's settings and applies them to what is
+// already stored, for example by dropping versions that are no longer
+// kept.
+func (vault *Vault) SetSettings(settings Settings, key []byte) error {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
+
+	if err := checkCodec(settings.Compression); err != nil {
+		return err
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	vault.Options = settings
+	for i := range vault.Files {
+		if err := vault.pruneVersions(i, key); err != nil {
+			return err
+		}
+	}
+	vault.purgeExpiredTrash()
+	return nil
+}
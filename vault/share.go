@@ -0,0 +1,189 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Entries are shared with another vault by encrypting them to its X25519
+// public key. A share starts with shareMagic, a big-endian uint16 version
+// and an ephemeral public key, followed by the entries in a stream like a
+// bundle's. The stream key is derived from the ephemeral key and from the
+// sender's own key pair, so only the recipient can read a share and it only
+// opens with the public key of the vault that wrote it.
+var shareMagic = []byte("SFSHARE\x00")
+
+const shareVersion = 1
+
+// shareAD is the associated data of a share's stream.
+var shareAD = []byte("secure-file-vault share")
+
+// keyPairAD is the associated data of the vault's sealed private key.
+var keyPairAD = []byte("secure-file-vault key pair")
+
+var (
+	ErrNotShare  = errors.New("not a vault share")
+	ErrNoKeyPair = errors.New("the vault has no key pair")
+)
+
+// PublicKey returns the public key other vaults share entries to. The
+// vault's key pair is created the first time, in which case created is set
+// and the vault needs saving.
+func (vault *Vault) PublicKey(key []byte) (publicKey []byte, created bool, err error) {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	if len(vault.KeyPair) > 0 {
+		private, err := vault.privateKey(key)
+		if err != nil {
+			return nil, false, err
+		}
+		return private.PublicKey().Bytes(), false, nil
+	}
+	if vault.readOnly {
+		return nil, false, ErrNoKeyPair
+	}
+
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, false, err
+	}
+	sealed, err := EncryptData(key, private.Bytes(), keyPairAD)
+	if err != nil {
+		return nil, false, err
+	}
+	vault.KeyPair = sealed
+	return private.PublicKey().Bytes(), true, nil
+}
+
+// privateKey opens the vault's private key. The caller must hold vault.mu.
+func (vault *Vault) privateKey(key []byte) (*ecdh.PrivateKey, error) {
+	if len(vault.KeyPair) == 0 {
+		return nil, ErrNoKeyPair
+	}
+	data, err := DecryptData(key, vault.KeyPair, keyPairAD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key pair: %v", err)
+	}
+	return ecdh.X25519().NewPrivateKey(data)
+}
+
+// Share writes the named entries and folders to w encrypted to recipient,
+// the public key of another vault, choosing them as ExportBundle does. It
+// returns the names the entries have in the share.
+func (vault *Vault) Share(names []string, recipient, key []byte, w io.Writer) ([]string, error) {
+	recipientKey, err := ecdh.X25519().NewPublicKey(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+
+	items, err := vault.bundleItems(names, key)
+	if err != nil {
+		return nil, err
+	}
+
+	vault.mu.RLock()
+	private, err := vault.privateKey(key)
+	vault.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralSecret, err := ephemeral.ECDH(recipientKey)
+	if err != nil {
+		return nil, err
+	}
+	staticSecret, err := private.ECDH(recipientKey)
+	if err != nil {
+		return nil, err
+	}
+	streamKey, err := shareKey(ephemeralSecret, staticSecret, ephemeral.PublicKey().Bytes(), private.PublicKey().Bytes(), recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	var version [2]byte
+	binary.BigEndian.PutUint16(version[:], shareVersion)
+	header := append(append(append([]byte{}, shareMagic...), version[:]...), ephemeral.PublicKey().Bytes()...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return vault.writeEntryStream(w, streamKey, shareAD, items, key)
+}
+
+// AcceptShare adds the entries of a share written to this vault's public
+// key by the vault whose public key is sender, in the same way as
+// ImportBundle.
+func (vault *Vault) AcceptShare(r io.Reader, sender, key []byte, opts ImportOptions) ([]ImportResult, error) {
+	if vault.readOnly {
+		return nil, ErrReadOnly
+	}
+	senderKey, err := ecdh.X25519().NewPublicKey(sender)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+
+	br := bufio.NewReader(r)
+	header := make([]byte, len(shareMagic)+2+32)
+	if _, err := io.ReadFull(br, header); err != nil || !bytes.Equal(header[:len(shareMagic)], shareMagic) {
+		return nil, ErrNotShare
+	}
+	if v := binary.BigEndian.Uint16(header[len(shareMagic):]); v != shareVersion {
+		return nil, fmt.Errorf("unsupported share version %d", v)
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(header[len(shareMagic)+2:])
+	if err != nil {
+		return nil, ErrNotShare
+	}
+
+	vault.mu.RLock()
+	private, err := vault.privateKey(key)
+	vault.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralSecret, err := private.ECDH(ephemeral)
+	if err != nil {
+		return nil, ErrNotShare
+	}
+	staticSecret, err := private.ECDH(senderKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	streamKey, err := shareKey(ephemeralSecret, staticSecret, ephemeral.Bytes(), sender, private.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	results, err := vault.readEntryStream(br, streamKey, shareAD, key, opts)
+	if err == errWrongStreamKey {
+		return nil, fmt.Errorf("the share is damaged, or was not sent to this vault by that sender")
+	}
+	return results, err
+}
+
+// shareKey derives a share's stream key from the secret shared through
+// the ephemeral key and the one shared by the sender's and recipient's own
+// key pairs, bound to all three public keys.
+func shareKey(ephemeralSecret, staticSecret, ephemeral, sender, recipient []byte) ([]byte, error) {
+	secret := append(append([]byte{}, ephemeralSecret...), staticSecret...)
+	salt := append(append(append([]byte{}, ephemeral...), sender...), recipient...)
+	streamKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte("secure-file-vault share key")), streamKey); err != nil {
+		return nil, err
+	}
+	return streamKey, nil
+}
@@ -0,0 +1,82 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// publicKey returns vault's public key, creating its key pair.
+func publicKey(t *testing.T, vault *Vault, key []byte) []byte {
+	t.Helper()
+	publicKey, _, err := vault.PublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publicKey
+}
+
+func TestShare(t *testing.T) {
+	alice, aliceKey, alicePath := newTestVault(t)
+	bob, bobKey, _ := newTestVault(t)
+	carol, carolKey, _ := newTestVault(t)
+
+	alicePublic, created, err := alice.PublicKey(aliceKey)
+	if err != nil || !created {
+		t.Fatalf("creating a key pair: %v, created %v", err, created)
+	}
+	if _, err := bob.Share(nil, alicePublic, bobKey, &bytes.Buffer{}); !errors.Is(err, ErrNoKeyPair) {
+		t.Errorf("sharing without a key pair returned %v, want ErrNoKeyPair", err)
+	}
+	bobPublic := publicKey(t, bob, bobKey)
+	carolPublic := publicKey(t, carol, carolKey)
+
+	meta := Metadata{Note: "for bob"}
+	if err := alice.AddFileWithMetadata("docs/x.txt", bytes.NewReader([]byte("secret")), meta, aliceKey); err != nil {
+		t.Fatal(err)
+	}
+	var share bytes.Buffer
+	if _, err := alice.Share([]string{"docs/x.txt"}, bobPublic, aliceKey, &share); err != nil {
+		t.Fatal(err)
+	}
+
+	// Carol cannot open a share sent to Bob, and Bob does not accept it as
+	// coming from Carol.
+	if results, err := carol.AcceptShare(bytes.NewReader(share.Bytes()), alicePublic, carolKey, ImportOptions{}); err == nil || len(results) != 0 {
+		t.Errorf("share opened by the wrong recipient: %v, %v", results, err)
+	}
+	if results, err := bob.AcceptShare(bytes.NewReader(share.Bytes()), carolPublic, bobKey, ImportOptions{}); err == nil || len(results) != 0 {
+		t.Errorf("share accepted from the wrong sender: %v, %v", results, err)
+	}
+	if files, _ := carol.List(carolKey); len(files) != 0 {
+		t.Errorf("the wrong recipient got %d entries", len(files))
+	}
+	if _, err := bob.AcceptShare(bytes.NewReader([]byte("garbage")), alicePublic, bobKey, ImportOptions{}); !errors.Is(err, ErrNotShare) {
+		t.Errorf("accepting garbage returned %v, want ErrNotShare", err)
+	}
+
+	if _, err := bob.AcceptShare(bytes.NewReader(share.Bytes()), alicePublic, bobKey, ImportOptions{Dest: "from alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readEntry(bob, "from alice/x.txt", bobKey); err != nil || data != "secret" {
+		t.Errorf("shared entry holds %q, %v", data, err)
+	}
+	if got, err := bob.Metadata("from alice/x.txt", bobKey); err != nil || got.Note != "for bob" {
+		t.Errorf("shared note %q, %v", got.Note, err)
+	}
+
+	// The key pair is kept with the vault.
+	if err := alice.Save(alicePath); err != nil {
+		t.Fatal(err)
+	}
+	alice.Close()
+	reopened, key, err := OpenVault(alicePath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	again, created, err := reopened.PublicKey(key)
+	if err != nil || created || !bytes.Equal(again, alicePublic) {
+		t.Errorf("key pair not kept: created %v, %v", created, err)
+	}
+}
@@ -0,0 +1,84 @@
+package vault
+
+import "os"
+
+// Stats describes how much space the vault's bodies take. Sizes are in
+// bytes; TotalSize counts every entry, version and trashed entry as if it
+// were stored on its own, and UniqueSize counts each distinct body once.
+// Compressed is how many of the distinct bodies are stored compressed.
+type Stats struct {
+	Files      int
+	Versions   int
+	Trashed    int
+	Blobs      int
+	Compressed int
+	TotalSize  int64
+	UniqueSize int64
+	StoredSize int64
+	SavedSize  int64
+}
+
+// CompressionRatio is the size of the distinct bodies on disk relative to
+// their uncompressed size, so 0.25 means they take a quarter of the space.
+// It is 1 for an empty vault.
+func (stats Stats) CompressionRatio() float64 {
+	if stats.UniqueSize == 0 {
+		return 1
+	}
+	return float64(stats.StoredSize) / float64(stats.UniqueSize)
+}
+
+// Stats returns how many bodies the vault holds and how much deduplication
+// and compression save. StoredSize is the size of the blobs on disk, including encryption
+// overhead.
+func (vault *Vault) Stats(key []byte) (Stats, error) {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+
+	var stats Stats
+	sizes := make(map[string]int64)
+	count := func(file FileEntry, content Version) error {
+		meta, err := vault.cache.metadata(key, file.Index, file.Name, content.Meta)
+		if err != nil {
+			return err
+		}
+		stats.TotalSize += meta.Size
+		if _, ok := sizes[content.Blob]; !ok && meta.Codec != CodecNone {
+			stats.Compressed++
+		}
+		sizes[content.Blob] = meta.Size
+		return nil
+	}
+	countEntry := func(file FileEntry) error {
+		for _, version := range file.Versions {
+			if err := count(file, version); err != nil {
+				return err
+			}
+		}
+		stats.Versions += len(file.Versions)
+		return count(file, file.current())
+	}
+
+	for _, file := range vault.Files {
+		if err := countEntry(file); err != nil {
+			return Stats{}, err
+		}
+	}
+	for _, trashed := range vault.Trash {
+		if err := countEntry(trashed.FileEntry); err != nil {
+			return Stats{}, err
+		}
+	}
+	stats.Files = len(vault.Files)
+	stats.Trashed = len(vault.Trash)
+
+	stats.Blobs = len(sizes)
+	for blob, size := range sizes {
+		stats.UniqueSize += size
+		if info, err := os.Stat(vault.blobPath(blob)); err == nil {
+			stats.StoredSize += info.Size()
+		}
+	}
+	stats.SavedSize = stats.TotalSize - stats.UniqueSize
+	return stats, nil
+}
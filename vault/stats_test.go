@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIdenticalBodiesShareABlob(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := vault.AddFile(name, []byte("same"), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if vault.Files[0].Blob != vault.Files[1].Blob {
+		t.Fatal("identical bodies were stored twice")
+	}
+
+	// Removing one copy must keep the blob for the other.
+	if err := vault.RemoveFile("a.txt", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.EmptyTrash(); err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n <= BackupCount; n++ {
+		if err := vault.Save(vaultPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, err := readEntry(vault, "b.txt", key); err != nil || data != "same" {
+		t.Fatalf("extracting the remaining copy: %q, %v", data, err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	same := bytes.Repeat([]byte("same body "), 100)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := vault.AddFile(name, same, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vault.AddFile("other.bin", []byte("other"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.UpdateFile("other.bin", key, same); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RemoveFile("c.txt", key); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := vault.Stats(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a.txt, b.txt, the trashed c.txt and the current other.bin share one
+	// blob; the old version of other.bin has its own.
+	size := int64(len(same))
+	want := Stats{Files: 3, Versions: 1, Trashed: 1, Blobs: 2, TotalSize: 4*size + 5, UniqueSize: size + 5, SavedSize: 3 * size}
+	stats.Compressed, stats.StoredSize = 0, 0
+	if stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestContentIDsAreKeyed(t *testing.T) {
+	first, firstKey, _ := newTestVault(t)
+	second, secondKey, _ := newTestVault(t)
+	for _, test := range []struct {
+		vault *Vault
+		key   []byte
+	}{{first, firstKey}, {second, secondKey}} {
+		if err := test.vault.AddFile("a.txt", []byte("same"), test.key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The blob name does not give away that two vaults hold the same body.
+	if first.Files[0].Blob == second.Files[0].Blob {
+		t.Error("the same body has the same blob name in two vaults")
+	}
+}
@@ -0,0 +1,204 @@
+package vault
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// A stream starts with a version byte and a random salt. The file key and
+// the salt give a per-stream AES-256-GCM key through HKDF, and the
+// plaintext follows in chunks of streamChunkSize bytes, each sealed on its
+// own. A chunk's nonce holds its position in the stream and whether it is
+// the last one, so chunks cannot be reordered, dropped or cut off the end
+// without failing authentication.
+const (
+	streamVersion   = 1
+	streamSaltSize  = 32
+	streamChunkSize = 64 * 1024
+)
+
+var errStreamTruncated = errors.New("encrypted stream is truncated")
+
+func newStreamAEAD(key, salt []byte) (cipher.AEAD, error) {
+	streamKey := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, key, salt, []byte("secure-file-vault stream"))
+	if _, err := io.ReadFull(kdf, streamKey); err != nil {
+		return nil, err
+	}
+	return newGCM(streamKey)
+}
+
+func streamNonce(nonce []byte, counter uint64, last bool) {
+	clear(nonce)
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+}
+
+type streamWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	ad      []byte
+	nonce   []byte
+	buf     []byte
+	out     []byte
+	counter uint64
+	closed  bool
+}
+
+// NewStreamWriter returns a writer that encrypts everything written to it
+// into w. Close must be called to write the final chunk; it does not close
+// w. The same additionalData must be given to NewStreamReader.
+func NewStreamWriter(w io.Writer, key, additionalData []byte) (io.WriteCloser, error) {
+	salt := make([]byte, streamSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := newStreamAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(append([]byte{streamVersion}, salt...)); err != nil {
+		return nil, err
+	}
+
+	return &streamWriter{
+		w:     w,
+		aead:  aead,
+		ad:    additionalData,
+		nonce: make([]byte, aead.NonceSize()),
+		buf:   make([]byte, 0, streamChunkSize),
+		out:   make([]byte, 0, streamChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if sw.closed {
+		return 0, errors.New("write to closed stream")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only flushed once more data arrives, so that the
+		// last chunk can always be marked as such on Close.
+		if len(sw.buf) == streamChunkSize {
+			if err := sw.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(sw.buf[len(sw.buf):streamChunkSize], p)
+		sw.buf = sw.buf[:len(sw.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (sw *streamWriter) Close() error {
+	if sw.closed {
+		return nil
+	}
+	sw.closed = true
+	return sw.flush(true)
+}
+
+func (sw *streamWriter) flush(last bool) error {
+	streamNonce(sw.nonce, sw.counter, last)
+	sw.out = sw.aead.Seal(sw.out[:0], sw.nonce, sw.buf, sw.ad)
+	sw.buf = sw.buf[:0]
+	sw.counter++
+
+	_, err := sw.w.Write(sw.out)
+	return err
+}
+
+type streamReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	ad      []byte
+	nonce   []byte
+	buf     []byte
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+// NewStreamReader returns a reader that decrypts a stream written by
+// NewStreamWriter. Read only returns plaintext that has been authenticated,
+// and reports an error if the stream was altered or truncated.
+func NewStreamReader(r io.Reader, key, additionalData []byte) (io.Reader, error) {
+	header := make([]byte, 1+streamSaltSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errStreamTruncated
+	}
+	if header[0] != streamVersion {
+		return nil, fmt.Errorf("unsupported stream version %d", header[0])
+	}
+
+	aead, err := newStreamAEAD(key, header[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamReader{
+		r:     bufio.NewReader(r),
+		aead:  aead,
+		ad:    additionalData,
+		nonce: make([]byte, aead.NonceSize()),
+		buf:   make([]byte, streamChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (sr *streamReader) Read(p []byte) (int, error) {
+	for len(sr.plain) == 0 {
+		if sr.done {
+			return 0, io.EOF
+		}
+		if err := sr.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, sr.plain)
+	sr.plain = sr.plain[n:]
+	return n, nil
+}
+
+func (sr *streamReader) readChunk() error {
+	n, err := io.ReadFull(sr.r, sr.buf)
+	last := false
+	switch err {
+	case nil:
+		if _, err := sr.r.Peek(1); err == io.EOF {
+			last = true
+		}
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		return errStreamTruncated
+	default:
+		return err
+	}
+
+	streamNonce(sr.nonce, sr.counter, last)
+	plain, err := sr.aead.Open(sr.buf[:0], sr.nonce, sr.buf[:n], sr.ad)
+	if err != nil {
+		return fmt.Errorf("message authentication failed")
+	}
+
+	sr.plain = plain
+	sr.counter++
+	sr.done = last
+	return nil
+}
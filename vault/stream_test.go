@@ -0,0 +1,131 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+var (
+	testStreamKey = bytes.Repeat([]byte{7}, 32)
+	testStreamAD  = []byte("entry")
+)
+
+const (
+	streamHeaderSize = 1 + streamSaltSize
+	sealedChunkSize  = streamChunkSize + 16
+)
+
+func encryptStream(t *testing.T, plaintext []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewStreamWriter(&buf, testStreamKey, testStreamAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptStream(stream, key, ad []byte) ([]byte, error) {
+	r, err := NewStreamReader(bytes.NewReader(stream), key, ad)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, streamChunkSize - 1, streamChunkSize, streamChunkSize + 1, 3 * streamChunkSize} {
+		plaintext := randomBytes(t, size)
+		got, err := decryptStream(encryptStream(t, plaintext), testStreamKey, testStreamAD)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatalf("size %d: plaintext does not round trip", size)
+		}
+	}
+}
+
+func TestStreamRejectsTruncation(t *testing.T) {
+	stream := encryptStream(t, randomBytes(t, 2*streamChunkSize+100))
+
+	for name, length := range map[string]int{
+		"header only":        streamHeaderSize,
+		"partial header":     streamHeaderSize - 1,
+		"last chunk dropped": streamHeaderSize + 2*sealedChunkSize,
+		"chunk cut short":    streamHeaderSize + sealedChunkSize + 10,
+		"last chunk cut":     len(stream) - 1,
+	} {
+		if _, err := decryptStream(stream[:length], testStreamKey, testStreamAD); err == nil {
+			t.Errorf("%s: truncated stream decrypted", name)
+		}
+	}
+}
+
+func TestStreamRejectsReorderedChunks(t *testing.T) {
+	stream := encryptStream(t, randomBytes(t, 3*streamChunkSize))
+
+	first := stream[streamHeaderSize : streamHeaderSize+sealedChunkSize]
+	second := stream[streamHeaderSize+sealedChunkSize : streamHeaderSize+2*sealedChunkSize]
+	var reordered []byte
+	reordered = append(reordered, stream[:streamHeaderSize]...)
+	reordered = append(reordered, second...)
+	reordered = append(reordered, first...)
+	reordered = append(reordered, stream[streamHeaderSize+2*sealedChunkSize:]...)
+
+	if _, err := decryptStream(reordered, testStreamKey, testStreamAD); err == nil {
+		t.Error("stream with reordered chunks decrypted")
+	}
+}
+
+func TestStreamRejectsDataAfterLastChunk(t *testing.T) {
+	// A short stream is a single chunk marked last. Anything appended to it
+	// makes that chunk a middle one, whose nonce no longer matches.
+	short := encryptStream(t, []byte("short"))
+	long := encryptStream(t, randomBytes(t, 2*streamChunkSize))
+	extended := append(append([]byte{}, short...), long[streamHeaderSize:streamHeaderSize+sealedChunkSize]...)
+
+	if _, err := decryptStream(extended, testStreamKey, testStreamAD); err == nil {
+		t.Error("stream with a chunk after the last one decrypted")
+	}
+
+	// A middle chunk cannot pass for the last one either.
+	if _, err := decryptStream(long[:streamHeaderSize+sealedChunkSize], testStreamKey, testStreamAD); err == nil {
+		t.Error("stream ending in a middle chunk decrypted")
+	}
+}
+
+func TestStreamRejectsTampering(t *testing.T) {
+	stream := encryptStream(t, randomBytes(t, 1000))
+
+	tampered := append([]byte{}, stream...)
+	tampered[len(tampered)/2] ^= 1
+	if _, err := decryptStream(tampered, testStreamKey, testStreamAD); err == nil {
+		t.Error("tampered stream decrypted")
+	}
+
+	if _, err := decryptStream(stream, testStreamKey, []byte("other entry")); err == nil {
+		t.Error("stream decrypted with the wrong additional data")
+	}
+
+	if _, err := decryptStream(stream, bytes.Repeat([]byte{8}, 32), testStreamAD); err == nil {
+		t.Error("stream decrypted with the wrong key")
+	}
+}
@@ -0,0 +1,188 @@
+package vault
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TrashEntry is an entry removed with RemoveFile or RemoveDir. It keeps
+// its body and versions until it is purged, either explicitly or once it
+// is older than Settings.TrashMaxAge. Dirs holds the encrypted names of
+// the empty folders RemoveDir removed along with it, which are created
+// again when it is restored.
+type TrashEntry struct {
+	FileEntry
+	Deleted time.Time
+	Dirs    []string
+}
+
+// TrashInfo describes an entry in the trash. Index identifies it to
+// RestoreFromTrash and PurgeTrash.
+type TrashInfo struct {
+	Index   uint64
+	Name    string
+	Deleted time.Time
+	Metadata
+}
+
+// trashFile moves the entry at position i in Files to the trash. The
+// caller must hold vault.mu.
+func (vault *Vault) trashFile(i int, deleted time.Time) {
+	vault.Trash = append(vault.Trash, TrashEntry{FileEntry: vault.Files[i], Deleted: deleted})
+	vault.Files = append(vault.Files[:i], vault.Files[i+1:]...)
+}
+
+// ListTrash returns the entries in the trash, most recently deleted first.
+func (vault *Vault) ListTrash(key []byte) ([]TrashInfo, error) {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+
+	infos := make([]TrashInfo, 0, len(vault.Trash))
+	for _, entry := range vault.Trash {
+		name, err := vault.decryptName(key, entry.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt filename: %v", err)
+		}
+		meta, err := vault.fileMetadata(key, entry.FileEntry)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, TrashInfo{Index: entry.Index, Name: name, Deleted: entry.Deleted, Metadata: meta})
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].Deleted.After(infos[j].Deleted)
+	})
+	return infos, nil
+}
+
+func (vault *Vault) findTrash(index uint64) int {
+	for i, entry := range vault.Trash {
+		if entry.Index == index {
+			return i
+		}
+	}
+	return -1
+}
+
+// RestoreFromTrash puts a trashed entry back under its old name, along with
+// the folders removed with it. It fails if that name has been taken since.
+func (vault *Vault) RestoreFromTrash(index uint64, key []byte) error {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	i := vault.findTrash(index)
+	if i < 0 {
+		return fmt.Errorf("entry not found in trash")
+	}
+	entry := vault.Trash[i]
+
+	name, err := vault.decryptName(key, entry.Name)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt filename: %v", err)
+	}
+	if err := vault.checkNewFile(name, key); err != nil {
+		return fmt.Errorf("cannot restore %s: %v", name, err)
+	}
+
+	vault.Files = append(vault.Files, entry.FileEntry)
+	vault.Trash = append(vault.Trash[:i], vault.Trash[i+1:]...)
+	return vault.restoreDirs(entry.Dirs, key)
+}
+
+// restoreDirs adds back the folders in encryptedDirs that do not exist
+// again and whose names are free. The caller must hold vault.mu.
+func (vault *Vault) restoreDirs(encryptedDirs []string, key []byte) error {
+	if len(encryptedDirs) == 0 {
+		return nil
+	}
+
+	files, _, err := vault.paths(key)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(vault.Dirs))
+	for _, encryptedDir := range vault.Dirs {
+		dir, err := vault.decryptName(key, encryptedDir)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt folder name: %v", err)
+		}
+		existing[dir] = true
+	}
+
+	for _, encryptedDir := range encryptedDirs {
+		dir, err := vault.decryptName(key, encryptedDir)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt folder name: %v", err)
+		}
+		if existing[dir] || checkNewPath(dir, files, nil) != nil {
+			continue
+		}
+		vault.Dirs = append(vault.Dirs, encryptedDir)
+		existing[dir] = true
+	}
+	return nil
+}
+
+// PurgeTrash permanently deletes an entry from the trash. Its blobs are
+// removed by the next Save.
+func (vault *Vault) PurgeTrash(index uint64) error {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	i := vault.findTrash(index)
+	if i < 0 {
+		return fmt.Errorf("entry not found in trash")
+	}
+	vault.UnreferencedBlobs = append(vault.UnreferencedBlobs, vault.Trash[i].blobs()...)
+	vault.Trash = append(vault.Trash[:i], vault.Trash[i+1:]...)
+	return nil
+}
+
+// EmptyTrash permanently deletes everything in the trash.
+func (vault *Vault) EmptyTrash() error {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	vault.purgeTrash(func(TrashEntry) bool { return true })
+	return nil
+}
+
+// purgeExpiredTrash deletes trashed entries older than the vault's
+// Settings.TrashMaxAge and reports whether there were any. The caller must
+// hold vault.mu.
+func (vault *Vault) purgeExpiredTrash() bool {
+	if vault.Options.TrashMaxAge <= 0 {
+		return false
+	}
+	return vault.purgeTrash(func(entry TrashEntry) bool {
+		return time.Since(entry.Deleted) > vault.Options.TrashMaxAge
+	})
+}
+
+func (vault *Vault) purgeTrash(expired func(TrashEntry) bool) bool {
+	var kept []TrashEntry
+	for _, entry := range vault.Trash {
+		if expired(entry) {
+			vault.UnreferencedBlobs = append(vault.UnreferencedBlobs, entry.blobs()...)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	purged := len(kept) < len(vault.Trash)
+	vault.Trash = kept
+	return purged
+}
@@ -0,0 +1,183 @@
+package vault
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func trashIndex(t *testing.T, vault *Vault, key []byte, name string) uint64 {
+	t.Helper()
+	trash, err := vault.ListTrash(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range trash {
+		if entry.Name == name {
+			return entry.Index
+		}
+	}
+	t.Fatalf("%s is not in the trash", name)
+	return 0
+}
+
+func TestTrashRestore(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	if err := vault.AddFile("a.txt", []byte("a"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RemoveFile("a.txt", key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readEntry(vault, "a.txt", key); err == nil {
+		t.Fatal("removed entry can still be read")
+	}
+	index := trashIndex(t, vault, key, "a.txt")
+
+	// The name was taken in the meantime.
+	if err := vault.AddFile("a.txt", []byte("new"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RestoreFromTrash(index, key); err == nil {
+		t.Fatal("restored over an existing entry")
+	}
+	if err := vault.RemoveFile("a.txt", key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vault.RestoreFromTrash(index, key); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readEntry(vault, "a.txt", key); err != nil || data != "a" {
+		t.Errorf("restored entry: %q, %v", data, err)
+	}
+	if trash, _ := vault.ListTrash(key); len(trash) != 1 {
+		t.Errorf("%d entries left in the trash, want 1", len(trash))
+	}
+}
+
+func TestTrashPurge(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := vault.AddFile(name, []byte(name), key); err != nil {
+			t.Fatal(err)
+		}
+		if err := vault.RemoveFile(name, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index := trashIndex(t, vault, key, "a.txt")
+	if err := vault.PurgeTrash(index); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RestoreFromTrash(index, key); err == nil {
+		t.Error("restored a purged entry")
+	}
+	if trash, _ := vault.ListTrash(key); len(trash) != 2 {
+		t.Fatalf("%d entries in the trash, want 2", len(trash))
+	}
+
+	if err := vault.EmptyTrash(); err != nil {
+		t.Fatal(err)
+	}
+	if trash, _ := vault.ListTrash(key); len(trash) != 0 {
+		t.Fatalf("%d entries in the trash after emptying it", len(trash))
+	}
+	if len(vault.UnreferencedBlobs) != 3 {
+		t.Errorf("%d blobs left for the next save to delete, want 3", len(vault.UnreferencedBlobs))
+	}
+}
+
+func TestTrashExpires(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+	if err := vault.SetSettings(Settings{TrashMaxAge: time.Hour}, key); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"old.txt", "new.txt"} {
+		if err := vault.AddFile(name, []byte(name), key); err != nil {
+			t.Fatal(err)
+		}
+		if err := vault.RemoveFile(name, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vault.Trash[0].Deleted = time.Now().Add(-2 * time.Hour)
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+
+	reopened, key, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	trash, err := reopened.ListTrash(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].Name != "new.txt" {
+		t.Errorf("trash after reopening: %+v, want only new.txt", trash)
+	}
+}
+
+func TestRemoveDirRestoresFolders(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	for _, name := range []string{"docs/a.txt", "docs/sub/b.txt"} {
+		if err := vault.AddFile(name, []byte(name), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{"docs/empty", "docs/sub/deeper/empty"} {
+		if err := vault.Mkdir(dir, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vault.AddFile("other.txt", []byte("other"), key); err != nil {
+		t.Fatal(err)
+	}
+	before, err := vault.ListDirs(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vault.RemoveDir("docs", key); err != nil {
+		t.Fatal(err)
+	}
+	if dirs, _ := vault.ListDirs(key); len(dirs) != 0 {
+		t.Fatalf("folders left after removing docs: %v", dirs)
+	}
+
+	trash, err := vault.ListTrash(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range trash {
+		if err := vault.RestoreFromTrash(entry.Index, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after, err := vault.ListDirs(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(after, before) {
+		t.Errorf("folders after restoring: %v, want %v", after, before)
+	}
+
+	// Restoring one entry is enough to bring the empty folders back, and
+	// they are only added once.
+	if err := vault.RemoveDir("docs", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RestoreFromTrash(trashIndex(t, vault, key, "docs/a.txt"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RestoreFromTrash(trashIndex(t, vault, key, "docs/sub/b.txt"), key); err != nil {
+		t.Fatal(err)
+	}
+	if len(vault.Dirs) != 2 {
+		t.Errorf("%d folders stored, want 2", len(vault.Dirs))
+	}
+}
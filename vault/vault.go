@@ -1,18 +1,35 @@
 package vault
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/gob"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 )
 
+// Vault is safe for concurrent use. Its exported fields are only for
+// encoding and must not be touched while other goroutines use the vault.
 type Vault struct {
-	Salt    string      `json:"salt"`
-	KeyHash string      `json:"key_hash"`
-	Files   []FileEntry `json:"files"`
+	mu                sync.RWMutex
+	cache             nameCache
+	header            Header
+	path              string
+	lock              *fileLock
+	readOnly          bool
+	formatVersion     uint16
+	NextIndex         uint64            `json:"next_index"`
+	Files             []FileEntry       `json:"files"`
+	Trash             []TrashEntry      `json:"trash"`
+	Quarantine        []QuarantineEntry `json:"quarantine"`
+	Dirs              []string          `json:"dirs"`
+	Options           Settings          `json:"settings"`
+	UnreferencedBlobs []string          `json:"unreferenced_blobs"`
+	// KeyPair is the vault's X25519 private key for sharing, encrypted.
+	KeyPair []byte `json:"key_pair,omitempty"`
 }
 
 func CreateVault(vaultPath, password string) (*Vault, error) {
@@ -22,196 +39,591 @@ func CreateVault(vaultPath, password string) (*Vault, error) {
 		return nil, fmt.Errorf("failed to create directory: %v", err)
 	}
 
-	salt, err := GenerateSalt()
+	masterKey, err := newMasterKey()
 	if err != nil {
 		return nil, err
 	}
-	key, err := DeriveKey(password, salt)
-	if err != nil {
-		return nil, err
-	}
-	keyHash := sha256.Sum256(key)
 	vault := &Vault{
-		Salt:    base64.StdEncoding.EncodeToString(salt),
-		KeyHash: base64.StdEncoding.EncodeToString(keyHash[:]),
-		Files:   []FileEntry{},
+		header:        Header{Cipher: CipherAESGCM},
+		path:          vaultPath,
+		formatVersion: FormatVersion,
+		Files:         []FileEntry{},
 	}
-
-	file, err := os.Create(vaultPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create vault file: %v", err)
+	if err := vault.header.wrapMasterKey(password, masterKey); err != nil {
+		return nil, err
 	}
-	defer file.Close()
 
-	encoder := gob.NewEncoder(file)
-	err = encoder.Encode(vault)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encode vault: %v", err)
+	if err := vault.Save(vaultPath); err != nil {
+		return nil, fmt.Errorf("failed to create vault file: %v", err)
 	}
 
 	return vault, nil
 }
 
+// OpenVault decodes the vault at vaultPath and unlocks it with password,
+// returning the master key that encrypts its entries. Vaults in an older
+// format are upgraded and saved back, and are not opened if that save
+// fails. If the file does not decode, the error wraps ErrVaultCorrupted and
+// OpenBackup can be tried instead.
+//
+// The vault stays locked against other writers until Close. If another
+// process holds it, the error is a *LockedError.
 func OpenVault(vaultPath, password string) (*Vault, []byte, error) {
-	file, err := os.Open(vaultPath)
+	lock, err := lockVault(vaultPath)
 	if err != nil {
 		return nil, nil, err
 	}
-	defer file.Close()
 
-	var vault Vault
-	decoder := gob.NewDecoder(file)
-	err = decoder.Decode(&vault)
+	vault, key, err := openVaultFile(vaultPath, vaultPath, password, false)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to decode vault: %v", err)
+		lock.release()
+		return nil, nil, err
 	}
+	vault.lock = lock
+	return vault, key, nil
+}
 
-	salt, err := base64.StdEncoding.DecodeString(vault.Salt)
+// OpenVaultReadOnly opens the vault without taking the write lock, so it
+// works while another process has it open. Every change is refused with
+// ErrReadOnly.
+func OpenVaultReadOnly(vaultPath, password string) (*Vault, []byte, error) {
+	return openVaultFile(vaultPath, vaultPath, password, true)
+}
+
+// openVaultFile opens the vault stored in path, which is vaultPath itself
+// or one of its backups.
+func openVaultFile(path, vaultPath, password string, readOnly bool) (*Vault, []byte, error) {
+	vault, err := readVaultFile(path)
 	if err != nil {
 		return nil, nil, err
 	}
+	vault.path = vaultPath
+	vault.readOnly = readOnly
 
-	key, err := DeriveKey(password, salt)
+	switch vault.header.Cipher {
+	case CipherAESGCM, CipherAESCBC:
+	default:
+		return nil, nil, fmt.Errorf("unsupported cipher %q", vault.header.Cipher)
+	}
+
+	key, err := vault.header.unlock(password)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	keyHash := sha256.Sum256(key)
-	if base64.StdEncoding.EncodeToString(keyHash[:]) != vault.KeyHash {
-		return nil, nil, fmt.Errorf("invalid password")
+	if readOnly {
+		if vault.header.Cipher != CipherAESGCM || len(vault.header.WrappedKey) == 0 || vault.formatVersion < FormatVersion {
+			return nil, nil, fmt.Errorf("vault needs upgrading and cannot be opened read-only")
+		}
+		vault.numberVersions()
+		return vault, key, nil
 	}
-	return &vault, key, nil
+
+	upgraded := false
+	if vault.header.Cipher != CipherAESGCM {
+		if err := vault.upgradeCipher(key); err != nil {
+			return nil, nil, fmt.Errorf("failed to upgrade vault: %v", err)
+		}
+		upgraded = true
+	}
+
+	if len(vault.header.WrappedKey) == 0 {
+		key, err = vault.upgradeToMasterKey(password, key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to upgrade vault: %v", err)
+		}
+		upgraded = true
+	}
+
+	if vault.formatVersion < FormatVersion {
+		if err := vault.upgradeBlobs(key); err != nil {
+			return nil, nil, fmt.Errorf("failed to upgrade vault: %v", err)
+		}
+		vault.formatVersion = FormatVersion
+		upgraded = true
+	}
+
+	if vault.header.KDF.Algorithm != KDFArgon2id {
+		if err := vault.header.wrapMasterKey(password, key); err != nil {
+			return nil, nil, fmt.Errorf("failed to upgrade vault: %v", err)
+		}
+		upgraded = true
+	}
+
+	if vault.numberVersions() {
+		upgraded = true
+	}
+
+	if vault.purgeExpiredTrash() {
+		upgraded = true
+	}
+
+	if upgraded && path == vaultPath {
+		if err := vault.Save(vaultPath); err != nil {
+			return nil, nil, fmt.Errorf("failed to save upgraded vault: %v", err)
+		}
+	}
+	return vault, key, nil
 }
 
-func (vault *Vault) AddFile(filePath string, data []byte, key []byte) error {
-	//check for duplicate file
+// Close releases the write lock taken by OpenVault. The vault must not be
+// used afterwards.
+func (vault *Vault) Close() error {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	vault.cache.clear()
+	if vault.lock == nil {
+		return nil
+	}
+	err := vault.lock.release()
+	vault.lock = nil
+	return err
+}
+
+func (vault *Vault) ReadOnly() bool {
+	return vault.readOnly
+}
+
+// ChangePassword re-wraps the master key under a key derived from
+// newPassword and saves the vault. Entries are not re-encrypted.
+func (vault *Vault) ChangePassword(vaultPath, oldPassword, newPassword string) error {
+	change, err := vault.PreparePasswordChange(oldPassword, newPassword)
+	if err != nil {
+		return err
+	}
+	return change.Save(vaultPath)
+}
+
+// A PasswordChange is a new password for a vault that has been checked and
+// derived but not yet saved, so that it can be saved together with other
+// records of the password.
+type PasswordChange struct {
+	vault     *Vault
+	oldHeader Header
+	header    Header
+}
+
+// PreparePasswordChange checks oldPassword and wraps the master key under
+// newPassword. The vault is unchanged until the change is saved.
+func (vault *Vault) PreparePasswordChange(oldPassword, newPassword string) (*PasswordChange, error) {
+	if vault.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	vault.mu.RLock()
+	oldHeader := vault.header
+	vault.mu.RUnlock()
+
+	masterKey, err := oldHeader.unlock(oldPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	header := oldHeader
+	if err := header.wrapMasterKey(newPassword, masterKey); err != nil {
+		return nil, fmt.Errorf("failed to change password: %v", err)
+	}
+	return &PasswordChange{vault: vault, oldHeader: oldHeader, header: header}, nil
+}
+
+// Save switches the vault to the new password and saves it to vaultPath.
+// If the save fails the vault keeps its old password. It also fails if the
+// password was changed since the change was prepared.
+func (change *PasswordChange) Save(vaultPath string) error {
+	vault := change.vault
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	if !bytes.Equal(vault.header.WrappedKey, change.oldHeader.WrappedKey) || vault.header.KeyHash != change.oldHeader.KeyHash {
+		return fmt.Errorf("failed to change password: the password was changed meanwhile")
+	}
+
+	vault.header = change.header
+	if err := vault.save(vaultPath); err != nil {
+		vault.header = change.oldHeader
+		return fmt.Errorf("failed to change password: %v", err)
+	}
+	return nil
+}
+
+// rekey returns copies of the vault's entries re-encrypted from oldKey to
+// newKey, keeping their indexes.
+func (vault *Vault) rekey(oldKey, newKey []byte) ([]FileEntry, error) {
+	files := make([]FileEntry, 0, len(vault.Files))
 	for _, file := range vault.Files {
-		if file.Name == filePath {
-			return fmt.Errorf("file already exists")
+		fileName, err := DecryptFileName(oldKey, file.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt filename: %v", err)
+		}
+
+		data, err := DecryptData(oldKey, file.Data, entryAD(file.Index, file.Name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt data: %v", err)
+		}
+
+		encryptedFileName, err := EncryptFileName(newKey, fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		encryptedData, err := EncryptData(newKey, data, entryAD(file.Index, encryptedFileName))
+		if err != nil {
+			return nil, err
 		}
+
+		files = append(files, FileEntry{
+			Index: file.Index,
+			Name:  encryptedFileName,
+			Hash:  file.Hash,
+			Data:  encryptedData,
+		})
+	}
+	return files, nil
+}
+
+// upgradeCipher re-seals every entry of a vault written with AES-CBC using
+// AES-GCM.
+func (vault *Vault) upgradeCipher(key []byte) error {
+	files := make([]FileEntry, 0, len(vault.Files))
+	for _, file := range vault.Files {
+		fileName, err := decryptLegacyFileName(key, file.Name)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt filename: %v", err)
+		}
+
+		data, err := decryptLegacyData(key, file.Data)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt data: %v", err)
+		}
+
+		if HashData(data) != file.Hash {
+			return fmt.Errorf("file integrity check failed for %s", fileName)
+		}
+
+		entry, err := vault.sealEntry(key, fileName, data)
+		if err != nil {
+			return err
+		}
+		files = append(files, entry)
 	}
 
-	encryptedData, err := EncryptData(key, data)
+	vault.Files = files
+	vault.header.Cipher = CipherAESGCM
+	return nil
+}
+
+// sealEntry encrypts a new entry and assigns it the next free index.
+func (vault *Vault) sealEntry(key []byte, fileName string, data []byte) (FileEntry, error) {
+	encryptedFileName, err := EncryptFileName(key, fileName)
+	if err != nil {
+		return FileEntry{}, err
+	}
+
+	index := vault.NextIndex
+	encryptedData, err := EncryptData(key, data, entryAD(index, encryptedFileName))
+	if err != nil {
+		return FileEntry{}, err
+	}
+	vault.NextIndex++
+
+	return FileEntry{
+		Index: index,
+		Name:  encryptedFileName,
+		Hash:  HashData(data),
+		Data:  encryptedData,
+	}, nil
+}
+
+var errFileNotFound = errors.New("file not found")
+
+// entryIndex returns the position in Files of the entry with the given
+// index, or -1. The caller must hold vault.mu.
+func (vault *Vault) entryIndex(index uint64) int {
+	for i, file := range vault.Files {
+		if file.Index == index {
+			return i
+		}
+	}
+	return -1
+}
+
+// findFile returns the position in Files of the entry named filePath. The
+// caller must hold vault.mu.
+func (vault *Vault) findFile(filePath string, key []byte) (int, error) {
+	for i, file := range vault.Files {
+		decryptedFileName, err := vault.decryptName(key, file.Name)
+		if err != nil {
+			return -1, fmt.Errorf("failed to decrypt filename: %v", err)
+		}
+
+		if decryptedFileName == filePath {
+			return i, nil
+		}
+	}
+	return -1, errFileNotFound
+}
+
+// checkNewFile returns an error if an entry named filePath cannot be
+// added. The caller must hold vault.mu.
+func (vault *Vault) checkNewFile(filePath string, key []byte) error {
+	files, dirs, err := vault.paths(key)
 	if err != nil {
 		return err
 	}
+	return checkNewPath(filePath, files, dirs)
+}
+
+func (vault *Vault) AddFile(filePath string, data []byte, key []byte) error {
+	return vault.AddFileFrom(filePath, bytes.NewReader(data), key)
+}
+
+// AddFileFrom encrypts everything read from r into a new entry. The body is
+// streamed into its own blob, so memory use does not depend on its size.
+func (vault *Vault) AddFileFrom(filePath string, r io.Reader, key []byte) error {
+	return vault.AddFileWithMetadata(filePath, r, Metadata{}, key)
+}
+
+// AddFileWithMetadata is AddFileFrom for a file whose metadata is known.
+func (vault *Vault) AddFileWithMetadata(filePath string, r io.Reader, meta Metadata, key []byte) error {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
+
+	filePath, err := cleanPath(filePath)
+	if err != nil {
+		return err
+	}
+
+	// The body is encrypted without holding the lock, so a large file does
+	// not block other users of the vault. The name is checked again
+	// before the entry is added.
+	vault.mu.Lock()
+	err = vault.checkNewFile(filePath, key)
+	index := vault.NextIndex
+	vault.NextIndex++
+	vault.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
 	encryptedFileName, err := EncryptFileName(key, filePath)
 	if err != nil {
 		return err
 	}
 
-	fileHash := HashData(data)
+	body := newBodyReader(r)
+	meta.ContentType = body.contentType(filePath)
+	blob, err := vault.encryptBlob(key, vault.codecFor(meta.ContentType), body)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt data: %v", err)
+	}
+
+	meta.Size = body.size
+	meta.Added = time.Now()
+	meta.Updated = meta.Added
+	meta.Content = blob.id
+	meta.Codec = blob.codec
+	sealedMeta, err := sealMetadata(key, index, encryptedFileName, meta)
+	if err != nil {
+		blob.discard()
+		return fmt.Errorf("failed to encrypt metadata: %v", err)
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
 
-	FileEntry := FileEntry{
-		Name: encryptedFileName,
-		Hash: fileHash,
-		Data: encryptedData,
+	if err := vault.checkNewFile(filePath, key); err != nil {
+		blob.discard()
+		return err
+	}
+	if err := vault.storeBlob(blob); err != nil {
+		return err
 	}
 
-	vault.Files = append(vault.Files, FileEntry)
+	vault.Files = append(vault.Files, FileEntry{
+		Index: index,
+		Name:  encryptedFileName,
+		Hash:  blob.id,
+		Blob:  blob.id,
+		Meta:  sealedMeta,
+		Seq:   1,
+	})
 	return nil
 }
 
+// Save atomically replaces the vault file, keeping the previous versions
+// as backups, and then deletes blobs that nothing references any more.
 func (vault *Vault) Save(vaultPath string) error {
-	file, err := os.Create(vaultPath)
-	if err != nil {
-		return err
+	if vault.readOnly {
+		return ErrReadOnly
 	}
-	defer file.Close()
 
-	encoder := gob.NewEncoder(file)
-	err = encoder.Encode(vault)
-	if err != nil {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	return vault.save(vaultPath)
+}
+
+func (vault *Vault) save(vaultPath string) error {
+	if err := vault.writeVaultFile(vaultPath); err != nil {
 		return err
 	}
 
+	vault.removeBlobs(vaultPath)
 	return nil
 }
 
+// ListFiles returns decrypted copies of every entry with their names and
+// metadata. File bodies are not read.
 func (vault *Vault) ListFiles(key []byte) ([]FileEntry, error) {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+
 	var decryptedFiles []FileEntry
 	for _, file := range vault.Files {
-		decryptedFileName, err := DecryptFileName(key, file.Name)
+		decryptedFileName, err := vault.decryptName(key, file.Name)
+		if err != nil {
+			return nil, err
+		}
+		meta, err := vault.fileMetadata(key, file)
 		if err != nil {
 			return nil, err
 		}
 		decryptedFiles = append(decryptedFiles, FileEntry{
-			Name: decryptedFileName,
-			Hash: file.Hash,
-			Data: file.Data,
+			Index:    file.Index,
+			Name:     decryptedFileName,
+			Hash:     file.Hash,
+			Blob:     file.Blob,
+			Metadata: meta,
 		})
 	}
 	return decryptedFiles, nil
 }
 
+// RemoveFile moves the entry named filePath to the trash, from where it
+// can be restored until it is purged.
 func (vault *Vault) RemoveFile(filePath string, key []byte) error {
-	for i, file := range vault.Files {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
 
-		decryptedFileName, err := DecryptFileName(key, file.Name)
-		if err != nil {
-			return err
-		}
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
 
-		if decryptedFileName == filePath {
-			vault.Files = append(vault.Files[:i], vault.Files[i+1:]...)
-			return nil
-		}
+	i, err := vault.findFile(filePath, key)
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("file not found")
+
+	vault.trashFile(i, time.Now())
+	return nil
 }
 
 func (vault *Vault) ExtractFile(filePath string, key []byte, outputPath string) ([]byte, error) {
-	for _, file := range vault.Files {
-		decryptedFileName, err := DecryptFileName(key, file.Name)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decrypt filename: %v", err)
-		}
-
-		if decryptedFileName == filePath {
-			decryptedData, err := DecryptData(key, file.Data)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decrypt data: %v", err)
-			}
+	var buf bytes.Buffer
+	if err := vault.ExtractFileTo(filePath, key, &buf); err != nil {
+		return nil, err
+	}
 
-			// Verify file integrity
-			decryptedFileHash := HashData(decryptedData)
-			if decryptedFileHash != file.Hash {
-				return nil, fmt.Errorf("file integrity check failed for %s", filePath)
-			}
+	err := os.WriteFile(outputPath, buf.Bytes(), 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write extracted file: %v", err)
+	}
+	return buf.Bytes(), nil
+}
 
-			err = os.WriteFile(outputPath, decryptedData, 0644)
-			if err != nil {
-				return nil, fmt.Errorf("failed to write extracted file: %v", err)
-			}
-			return decryptedData, nil
-		}
+// ExtractFileTo decrypts the entry named filePath into w, a chunk at a
+// time. The body is checked against its content ID once it has all been
+// written.
+func (vault *Vault) ExtractFileTo(filePath string, key []byte, w io.Writer) error {
+	vault.mu.RLock()
+	i, err := vault.findFile(filePath, key)
+	if err != nil {
+		vault.mu.RUnlock()
+		return err
 	}
-	return nil, fmt.Errorf("file not found")
+	file := vault.Files[i]
+	vault.mu.RUnlock()
+
+	return vault.copyContent(key, file, file.current(), filePath, w)
 }
 
 func (vault *Vault) UpdateFile(fileName string, key []byte, newData []byte) error {
-	for i, file := range vault.Files {
-		decryptedFileName, err := DecryptFileName(key, file.Name)
-		if err != nil {
-			return fmt.Errorf("failed to decrypt filename: %v", err)
-		}
+	return vault.UpdateFileFrom(fileName, key, bytes.NewReader(newData))
+}
 
-		if decryptedFileName == fileName {
-			encryptedData, err := EncryptData(key, newData)
-			if err != nil {
-				return fmt.Errorf("failed to encrypt data: %v", err)
-			}
+// UpdateFileFrom replaces the body of the entry named fileName with
+// everything read from r. The rest of its metadata is kept, and the old
+// body is kept as a version as the vault's settings allow.
+func (vault *Vault) UpdateFileFrom(fileName string, key []byte, r io.Reader) error {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
 
-			fileHash := HashData(newData)
+	vault.mu.RLock()
+	i, err := vault.findFile(fileName, key)
+	var file FileEntry
+	if err == nil {
+		file = vault.Files[i]
+	}
+	vault.mu.RUnlock()
 
-			vault.Files[i] = FileEntry{
-				Name: file.Name, // Keep the original encrypted name
-				Hash: fileHash,
-				Data: encryptedData,
-			}
+	if err == errFileNotFound {
+		return fmt.Errorf("file not found: %s", fileName)
+	} else if err != nil {
+		return err
+	}
 
-			return nil
-		}
+	meta, err := vault.fileMetadata(key, file)
+	if err != nil {
+		return err
+	}
+
+	body := newBodyReader(r)
+	meta.ContentType = body.contentType(fileName)
+	blob, err := vault.encryptBlob(key, vault.codecFor(meta.ContentType), body)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt data: %v", err)
+	}
+	if blob.id == file.Blob {
+		// Nothing changed, so there is no new version to keep.
+		blob.discard()
+		return nil
+	}
+
+	meta.Size = body.size
+	meta.Updated = time.Now()
+	meta.Content = blob.id
+	meta.Codec = blob.codec
+	sealedMeta, err := sealMetadata(key, file.Index, file.Name, meta)
+	if err != nil {
+		blob.discard()
+		return fmt.Errorf("failed to encrypt metadata: %v", err)
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	// The entry may have been removed, renamed or replaced while the body
+	// was being encrypted.
+	i = vault.entryIndex(file.Index)
+	if i < 0 || vault.Files[i].Name != file.Name || !bytes.Equal(vault.Files[i].Meta, file.Meta) {
+		blob.discard()
+		return fmt.Errorf("file changed during update: %s", fileName)
+	}
+	if err := vault.storeBlob(blob); err != nil {
+		return err
+	}
+
+	vault.Files[i] = FileEntry{
+		Index:    file.Index,
+		Name:     file.Name, // Keep the original encrypted name
+		Hash:     blob.id,
+		Blob:     blob.id,
+		Meta:     sealedMeta,
+		Seq:      file.Seq + 1,
+		Versions: append(file.Versions, file.current()),
 	}
-	return fmt.Errorf("file not found: %s", fileName)
+	return vault.pruneVersions(i, key)
 }
@@ -0,0 +1,129 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+const testPassword = "correct horse battery staple"
+
+// newTestVault creates a vault in a temporary directory and opens it for
+// writing. It is closed when the test ends.
+func newTestVault(t testing.TB) (*Vault, []byte, string) {
+	t.Helper()
+	vaultPath := filepath.Join(t.TempDir(), "vault.dat")
+	created, err := CreateVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created.Close()
+
+	vault, key, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { vault.Close() })
+	return vault, key, vaultPath
+}
+
+// readEntry returns the body of the entry named filePath.
+func readEntry(vault *Vault, filePath string, key []byte) (string, error) {
+	var buf bytes.Buffer
+	err := vault.ExtractFileTo(filePath, key, &buf)
+	return buf.String(), err
+}
+
+// TestConcurrentUse adds, updates, lists, extracts and saves from several
+// goroutines at once. Run it with go test -race.
+func TestConcurrentUse(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+
+	const workers, filesPerWorker = 8, 10
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < filesPerWorker; i++ {
+				name := fmt.Sprintf("worker%d/file%d.txt", w, i)
+				if err := vault.AddFile(name, []byte(name), key); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := vault.UpdateFile(name, key, []byte("updated "+name)); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := vault.ListFiles(key); err != nil {
+					t.Error(err)
+					return
+				}
+				if data, err := readEntry(vault, name, key); err != nil || data != "updated "+name {
+					t.Errorf("extracting %s: %q, %v", name, data, err)
+					return
+				}
+				if err := vault.Save(vaultPath); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+
+	// Only one of several adds under the same name may succeed.
+	var added sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 4; i++ {
+		added.Add(1)
+		go func() {
+			defer added.Done()
+			if vault.AddFile("shared.txt", []byte("shared"), key) == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	added.Wait()
+	wg.Wait()
+	if succeeded != 1 {
+		t.Errorf("%d adds of the same name succeeded, want 1", succeeded)
+	}
+
+	var want []string
+	for w := 0; w < workers; w++ {
+		for i := 0; i < filesPerWorker; i++ {
+			want = append(want, fmt.Sprintf("worker%d/file%d.txt", w, i))
+		}
+	}
+	want = append(want, "shared.txt")
+	sort.Strings(want)
+
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+	reopened, key, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	files, err := reopened.ListFiles(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, file := range files {
+		got = append(got, file.Name)
+	}
+	sort.Strings(got)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("entries after concurrent use:\n got %v\nwant %v", got, want)
+	}
+}
@@ -0,0 +1,262 @@
+package vault
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Kinds of problem Verify reports.
+const (
+	ProblemBadName       = "bad name"
+	ProblemDuplicateName = "duplicate name"
+	ProblemBadMetadata   = "bad metadata"
+	ProblemMissingBlob   = "missing blob"
+	ProblemCorrupt       = "corrupt content"
+	ProblemBadFolder     = "bad folder name"
+	ProblemOrphanedBlob  = "orphaned blob"
+)
+
+// Problem is one thing wrong with a vault. Name is the entry's decrypted
+// name, if it could be decrypted. Version is the position of the bad body
+// in the entry's history, or -1 for its current body or the entry itself.
+type Problem struct {
+	Kind    string
+	Index   uint64
+	Name    string
+	Version int
+	Blob    string
+	InTrash bool
+	Detail  string
+}
+
+func (problem Problem) String() string {
+	var where []string
+	if problem.Name != "" {
+		where = append(where, problem.Name)
+	} else if problem.Kind != ProblemOrphanedBlob && problem.Kind != ProblemBadFolder {
+		where = append(where, fmt.Sprintf("entry %d", problem.Index))
+	}
+	if problem.Version >= 0 {
+		where = append(where, fmt.Sprintf("version %d", problem.Version+1))
+	}
+	if problem.Blob != "" && problem.Kind != ProblemCorrupt {
+		where = append(where, "blob "+problem.Blob)
+	}
+	if problem.InTrash {
+		where = append(where, "in trash")
+	}
+
+	text := problem.Kind
+	if len(where) > 0 {
+		text += ": " + strings.Join(where, ", ")
+	}
+	if problem.Detail != "" {
+		text += " (" + problem.Detail + ")"
+	}
+	return text
+}
+
+// VerifyReport is the result of Verify or Repair. Files, Trashed and
+// Bodies count what was checked. Repaired is set if the problems were
+// dealt with, and the vault needs saving.
+type VerifyReport struct {
+	Files    int
+	Trashed  int
+	Bodies   int
+	Problems []Problem
+	Repaired bool
+}
+
+// OK reports whether no problems were found.
+func (report VerifyReport) OK() bool {
+	return len(report.Problems) == 0
+}
+
+// QuarantineEntry is an entry, or a single version of one, that Repair
+// took out of the vault because it could not be read. It is kept, along
+// with its blob, in case it can be recovered by other means.
+type QuarantineEntry struct {
+	FileEntry
+	Reason      string
+	Quarantined time.Time
+}
+
+// Verify decrypts every entry's name, metadata and bodies, including those
+// of earlier versions and of the trash, and checks them against their
+// content IDs. It also reports entries sharing a name, folder names that
+// cannot be decrypted and blobs that nothing refers to.
+func (vault *Vault) Verify(key []byte) (VerifyReport, error) {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+	return vault.verify(key, false)
+}
+
+// Repair is Verify, but moves bad entries and versions to the vault's
+// quarantine, keeps the first of several entries with the same name,
+// drops folder names that cannot be decrypted and deletes orphaned blobs
+// when the vault is next saved.
+func (vault *Vault) Repair(key []byte) (VerifyReport, error) {
+	if vault.readOnly {
+		return VerifyReport{}, ErrReadOnly
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	return vault.verify(key, true)
+}
+
+// verify does the work of Verify and Repair. The caller must hold
+// vault.mu, for writing if repair is set.
+func (vault *Vault) verify(key []byte, repair bool) (VerifyReport, error) {
+	var report VerifyReport
+	var quarantine []QuarantineEntry
+
+	names := make(map[string]bool, len(vault.Files))
+	files := make([]FileEntry, 0, len(vault.Files))
+	for _, file := range vault.Files {
+		report.Files++
+		kept, bad, ok := vault.checkEntry(key, file, false, names, &report)
+		quarantine = append(quarantine, bad...)
+		if ok {
+			files = append(files, kept)
+		}
+	}
+
+	trash := make([]TrashEntry, 0, len(vault.Trash))
+	for _, entry := range vault.Trash {
+		report.Trashed++
+		kept, bad, ok := vault.checkEntry(key, entry.FileEntry, true, nil, &report)
+		quarantine = append(quarantine, bad...)
+		if ok {
+			entry.FileEntry = kept
+			trash = append(trash, entry)
+		}
+	}
+
+	dirs := make([]string, 0, len(vault.Dirs))
+	for _, encryptedDir := range vault.Dirs {
+		if _, err := vault.decryptName(key, encryptedDir); err != nil {
+			report.Problems = append(report.Problems, Problem{Kind: ProblemBadFolder, Version: -1, Detail: err.Error()})
+			continue
+		}
+		dirs = append(dirs, encryptedDir)
+	}
+
+	orphans, err := vault.orphanedBlobs()
+	if err != nil {
+		return report, err
+	}
+	for _, blob := range orphans {
+		report.Problems = append(report.Problems, Problem{Kind: ProblemOrphanedBlob, Version: -1, Blob: blob})
+	}
+
+	if repair && !report.OK() {
+		vault.Files = files
+		vault.Trash = trash
+		vault.Dirs = dirs
+		vault.Quarantine = append(vault.Quarantine, quarantine...)
+		vault.UnreferencedBlobs = append(vault.UnreferencedBlobs, orphans...)
+		report.Repaired = true
+	}
+	return report, nil
+}
+
+// checkEntry checks file's name and bodies, adding what it finds to report.
+// names holds the names seen so far, or is nil if duplicates do not matter.
+// It returns the entry without any bad versions and whether the entry
+// itself is good, along with what should be quarantined: the entry if it
+// is bad, or else each bad version as an entry of its own.
+func (vault *Vault) checkEntry(key []byte, file FileEntry, inTrash bool, names map[string]bool, report *VerifyReport) (FileEntry, []QuarantineEntry, bool) {
+	now := time.Now()
+	fail := func(entry FileEntry, problem Problem, err error) QuarantineEntry {
+		problem.Index, problem.InTrash = file.Index, inTrash
+		if err != nil {
+			problem.Detail = err.Error()
+		}
+		report.Problems = append(report.Problems, problem)
+		return QuarantineEntry{FileEntry: entry, Reason: problem.Kind, Quarantined: now}
+	}
+
+	name, err := vault.decryptName(key, file.Name)
+	if err != nil {
+		bad := fail(file, Problem{Kind: ProblemBadName, Version: -1}, err)
+		return file, []QuarantineEntry{bad}, false
+	}
+	if names != nil {
+		if names[name] {
+			bad := fail(file, Problem{Kind: ProblemDuplicateName, Name: name, Version: -1}, nil)
+			return file, []QuarantineEntry{bad}, false
+		}
+		names[name] = true
+	}
+
+	report.Bodies++
+	if kind, err := vault.checkContent(key, file, file.current(), name); err != nil {
+		bad := fail(file, Problem{Kind: kind, Name: name, Version: -1, Blob: file.Blob}, err)
+		return file, []QuarantineEntry{bad}, false
+	}
+
+	kept := file
+	kept.Versions = nil
+	var quarantine []QuarantineEntry
+	for n, version := range file.Versions {
+		report.Bodies++
+		kind, err := vault.checkContent(key, file, version, name)
+		if err == nil {
+			kept.Versions = append(kept.Versions, version)
+			continue
+		}
+
+		entry := file
+		entry.Blob, entry.Hash, entry.Meta, entry.Seq = version.Blob, version.Hash, version.Meta, version.Seq
+		entry.Versions = nil
+		quarantine = append(quarantine, fail(entry, Problem{Kind: kind, Name: name, Version: n, Blob: version.Blob}, err))
+	}
+	return kept, quarantine, true
+}
+
+// checkContent reads one body of file and returns what is wrong with it.
+func (vault *Vault) checkContent(key []byte, file FileEntry, content Version, name string) (string, error) {
+	if _, err := vault.cache.metadata(key, file.Index, file.Name, content.Meta); err != nil {
+		return ProblemBadMetadata, err
+	}
+	if _, err := os.Stat(vault.blobPath(content.Blob)); os.IsNotExist(err) {
+		return ProblemMissingBlob, fmt.Errorf("blob not found")
+	} else if err != nil {
+		return ProblemMissingBlob, err
+	}
+	if err := vault.copyContent(key, file, content, name, io.Discard); err != nil {
+		return ProblemCorrupt, err
+	}
+	return "", nil
+}
+
+// orphanedBlobs returns the blobs in the blob directory that nothing
+// refers to and that are not already waiting to be deleted. Temporary
+// files of bodies still being written are not blobs.
+func (vault *Vault) orphanedBlobs() ([]string, error) {
+	entries, err := os.ReadDir(vault.blobDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read blob directory: %v", err)
+	}
+
+	referenced := backupBlobs(vault.path)
+	vault.referencedBlobs(referenced)
+	for _, blob := range vault.UnreferencedBlobs {
+		referenced[blob] = true
+	}
+
+	var orphans []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || referenced[entry.Name()] {
+			continue
+		}
+		orphans = append(orphans, entry.Name())
+	}
+	return orphans, nil
+}
@@ -0,0 +1,130 @@
+package vault
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func problemKinds(report VerifyReport) []string {
+	var kinds []string
+	for _, problem := range report.Problems {
+		kinds = append(kinds, problem.Kind)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+func TestVerifyAndRepair(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+	if err := vault.AddFile("a.txt", []byte("a1"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.UpdateFile("a.txt", key, []byte("a2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.AddFile("b.txt", []byte("b"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.AddFile("old/c.txt", []byte("c"), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Mkdir("old/empty", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RemoveDir("old", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := vault.Verify(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Files != 2 || report.Trashed != 1 || report.Bodies != 4 {
+		t.Fatalf("report of a good vault: %+v", report)
+	}
+
+	// Corrupt a's first version, lose b's body, leave a blob nothing
+	// refers to, store a second a.txt and a folder name that is not
+	// encrypted.
+	if err := os.WriteFile(vault.blobPath(vault.Files[0].Versions[0].Blob), []byte("junk"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(vault.blobPath(vault.Files[1].Blob)); err != nil {
+		t.Fatal(err)
+	}
+	orphan := vault.blobPath("0123456789abcdef")
+	if err := os.WriteFile(orphan, []byte("orphan"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	vault.Files = append(vault.Files, vault.Files[0])
+	vault.Dirs = append(vault.Dirs, "garbage")
+
+	want := []string{ProblemBadFolder, ProblemCorrupt, ProblemDuplicateName, ProblemMissingBlob, ProblemOrphanedBlob}
+	report, err = vault.Verify(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := problemKinds(report); !slices.Equal(got, want) {
+		t.Fatalf("problems %v, want %v", got, want)
+	}
+	if report.Repaired || len(vault.Quarantine) != 0 || len(vault.Files) != 3 {
+		t.Fatal("Verify changed the vault")
+	}
+
+	report, err = vault.Repair(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := problemKinds(report); !report.Repaired || !slices.Equal(got, want) {
+		t.Fatalf("repair report: %+v", report)
+	}
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("orphaned blob was not deleted")
+	}
+
+	// a.txt is kept without its bad version, b.txt and the second a.txt
+	// are quarantined along with the bad version.
+	if data, err := readEntry(vault, "a.txt", key); err != nil || data != "a2" {
+		t.Errorf("a.txt after repair: %q, %v", data, err)
+	}
+	if versions, err := vault.Versions("a.txt", key); err != nil || len(versions) != 1 {
+		t.Errorf("a.txt has %d versions after repair, want 1: %v", len(versions), err)
+	}
+	if _, err := readEntry(vault, "b.txt", key); err == nil {
+		t.Error("b.txt is still in the vault")
+	}
+	var reasons []string
+	for _, entry := range vault.Quarantine {
+		reasons = append(reasons, entry.Reason)
+		if _, err := os.Stat(vault.blobPath(entry.Blob)); entry.Reason != ProblemMissingBlob && err != nil {
+			t.Errorf("blob of quarantined entry (%s) was deleted: %v", entry.Reason, err)
+		}
+	}
+	slices.Sort(reasons)
+	if want := []string{ProblemCorrupt, ProblemDuplicateName, ProblemMissingBlob}; !slices.Equal(reasons, want) {
+		t.Errorf("quarantined for %v, want %v", reasons, want)
+	}
+	if len(vault.Trash) != 1 || len(vault.Trash[0].Dirs) != 1 {
+		t.Error("trashed entry lost its folders in the repair")
+	}
+
+	vault.Close()
+	reopened, key, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if report, err := reopened.Verify(key); err != nil || !report.OK() {
+		t.Errorf("verifying the repaired vault: %v, %v", report.Problems, err)
+	}
+	if len(reopened.Quarantine) != 3 {
+		t.Errorf("%d entries quarantined after reopening, want 3", len(reopened.Quarantine))
+	}
+}
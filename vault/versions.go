@@ -0,0 +1,218 @@
+package vault
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Version is an earlier body of an entry, kept when the entry was updated.
+// Its metadata is sealed like the entry's current one. Seq numbers the
+// bodies of an entry from 1, oldest first; the current body always has the
+// highest number, so numbers are never reused. Blobs cannot identify a
+// version, since the same content can come back in a later update.
+type Version struct {
+	Blob string
+	Hash string
+	Meta []byte
+	Seq  uint64
+}
+
+// VersionInfo describes one version of an entry. ID identifies the version
+// to ExtractVersionTo and RestoreVersion.
+type VersionInfo struct {
+	ID      string
+	Hash    string
+	Current bool
+	Metadata
+}
+
+// current returns the entry's current body as a Version.
+func (file FileEntry) current() Version {
+	return Version{Blob: file.Blob, Hash: file.Hash, Meta: file.Meta, Seq: file.Seq}
+}
+
+// id is how a version is identified to callers.
+func (version Version) id() string {
+	return strconv.FormatUint(version.Seq, 10)
+}
+
+// numberVersions numbers the bodies of entries stored before versions
+// had numbers and reports whether there were any. The numbers only depend
+// on the order of the versions, so a read-only vault numbers them the
+// same way as the writer that saves them.
+func (vault *Vault) numberVersions() bool {
+	number := func(file *FileEntry) bool {
+		if file.Seq != 0 {
+			return false
+		}
+		for n := range file.Versions {
+			file.Versions[n].Seq = uint64(n + 1)
+		}
+		file.Seq = uint64(len(file.Versions) + 1)
+		return true
+	}
+
+	numbered := false
+	for i := range vault.Files {
+		numbered = number(&vault.Files[i]) || numbered
+	}
+	for i := range vault.Trash {
+		numbered = number(&vault.Trash[i].FileEntry) || numbered
+	}
+	for i := range vault.Quarantine {
+		numbered = number(&vault.Quarantine[i].FileEntry) || numbered
+	}
+	return numbered
+}
+
+// blobs returns every blob the entry references.
+func (file FileEntry) blobs() []string {
+	blobs := []string{file.Blob}
+	for _, version := range file.Versions {
+		blobs = append(blobs, version.Blob)
+	}
+	return blobs
+}
+
+// Versions returns the versions of the entry named filePath, oldest first.
+// The last one is the current version.
+func (vault *Vault) Versions(filePath string, key []byte) ([]VersionInfo, error) {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+
+	i, err := vault.findFile(filePath, key)
+	if err != nil {
+		return nil, err
+	}
+	file := vault.Files[i]
+
+	var infos []VersionInfo
+	for _, version := range file.Versions {
+		meta, err := vault.cache.metadata(key, file.Index, file.Name, version.Meta)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, VersionInfo{ID: version.id(), Hash: version.Hash, Metadata: meta})
+	}
+
+	meta, err := vault.fileMetadata(key, file)
+	if err != nil {
+		return nil, err
+	}
+	return append(infos, VersionInfo{ID: file.current().id(), Hash: file.Hash, Current: true, Metadata: meta}), nil
+}
+
+// ExtractVersionTo decrypts one version of the entry named filePath into w.
+func (vault *Vault) ExtractVersionTo(filePath, id string, key []byte, w io.Writer) error {
+	vault.mu.RLock()
+	i, err := vault.findFile(filePath, key)
+	if err != nil {
+		vault.mu.RUnlock()
+		return err
+	}
+	file := vault.Files[i]
+	vault.mu.RUnlock()
+
+	content := file.current()
+	if content.id() != id {
+		n := findVersion(file, id)
+		if n < 0 {
+			return fmt.Errorf("version not found: %s", id)
+		}
+		content = file.Versions[n]
+	}
+	return vault.copyContent(key, file, content, filePath, w)
+}
+
+// RestoreVersion makes an earlier version of the entry named filePath its
+// current one, under a new ID. The version being replaced is kept in the
+// history, so a restore can itself be undone.
+func (vault *Vault) RestoreVersion(filePath, id string, key []byte) error {
+	if vault.readOnly {
+		return ErrReadOnly
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+
+	i, err := vault.findFile(filePath, key)
+	if err != nil {
+		return err
+	}
+	file := vault.Files[i]
+	if file.current().id() == id {
+		return nil
+	}
+
+	n := findVersion(file, id)
+	if n < 0 {
+		return fmt.Errorf("version not found: %s", id)
+	}
+	restored := file.Versions[n]
+
+	// The restored body keeps the metadata it was stored with, apart from
+	// the note, which belongs to the entry rather than to a version.
+	meta, err := vault.cache.metadata(key, file.Index, file.Name, restored.Meta)
+	if err != nil {
+		return err
+	}
+	current, err := vault.fileMetadata(key, file)
+	if err != nil {
+		return err
+	}
+	meta.Note = current.Note
+	meta.Updated = time.Now()
+	sealedMeta, err := sealMetadata(key, file.Index, file.Name, meta)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt metadata: %v", err)
+	}
+
+	versions := append([]Version{}, file.Versions[:n]...)
+	versions = append(versions, file.Versions[n+1:]...)
+	versions = append(versions, file.current())
+
+	vault.Files[i].Blob = restored.Blob
+	vault.Files[i].Hash = restored.Hash
+	vault.Files[i].Meta = sealedMeta
+	vault.Files[i].Seq = file.Seq + 1
+	vault.Files[i].Versions = versions
+	return vault.pruneVersions(i, key)
+}
+
+func findVersion(file FileEntry, id string) int {
+	for n, version := range file.Versions {
+		if version.id() == id {
+			return n
+		}
+	}
+	return -1
+}
+
+// pruneVersions drops the versions of the entry at position i that the
+// vault's settings no longer keep. The caller must hold vault.mu.
+func (vault *Vault) pruneVersions(i int, key []byte) error {
+	file := &vault.Files[i]
+	keep := vault.Options.versionsToKeep()
+
+	var kept []Version
+	for n, version := range file.Versions {
+		drop := n < len(file.Versions)-keep
+		if !drop && vault.Options.VersionMaxAge > 0 {
+			meta, err := vault.cache.metadata(key, file.Index, file.Name, version.Meta)
+			if err != nil {
+				return err
+			}
+			drop = time.Since(meta.Updated) > vault.Options.VersionMaxAge
+		}
+
+		if drop {
+			vault.UnreferencedBlobs = append(vault.UnreferencedBlobs, version.Blob)
+		} else {
+			kept = append(kept, version)
+		}
+	}
+	file.Versions = kept
+	return nil
+}
@@ -0,0 +1,150 @@
+package vault
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// versionBodies returns the IDs of the versions of filePath and what each
+// holds, oldest first.
+func versionBodies(t *testing.T, vault *Vault, filePath string, key []byte) ([]string, []string) {
+	t.Helper()
+	versions, err := vault.Versions(filePath, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids, bodies []string
+	for _, version := range versions {
+		var buf bytes.Buffer
+		if err := vault.ExtractVersionTo(filePath, version.ID, key, &buf); err != nil {
+			t.Fatalf("version %s: %v", version.ID, err)
+		}
+		ids = append(ids, version.ID)
+		bodies = append(bodies, buf.String())
+	}
+	return ids, bodies
+}
+
+func checkUnique(t *testing.T, ids []string) {
+	t.Helper()
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			t.Fatalf("version ID %s used twice in %v", id, ids)
+		}
+		seen[id] = true
+	}
+}
+
+func TestVersionsOfRepeatedContent(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+
+	// The first and last bodies are the same blob.
+	for n, body := range []string{"A", "B", "A"} {
+		var err error
+		if n == 0 {
+			err = vault.AddFile("notes.txt", []byte(body), key)
+		} else {
+			err = vault.UpdateFile("notes.txt", key, []byte(body))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, bodies := versionBodies(t, vault, "notes.txt", key)
+	checkUnique(t, ids)
+	if got := strings.Join(bodies, ""); got != "ABA" {
+		t.Fatalf("versions hold %v, want A, B, A", bodies)
+	}
+
+	// Restoring the oldest A must pick that version, not the current one.
+	if err := vault.RestoreVersion("notes.txt", ids[0], key); err != nil {
+		t.Fatal(err)
+	}
+	restoredIDs, bodies := versionBodies(t, vault, "notes.txt", key)
+	checkUnique(t, restoredIDs)
+	if got := strings.Join(bodies, ""); got != "BAA" {
+		t.Fatalf("after restoring, versions hold %v, want B, A, A", bodies)
+	}
+	for _, id := range ids[1:] {
+		if !slices.Contains(restoredIDs, id) {
+			t.Errorf("version %s lost its ID after a restore: %v", id, restoredIDs)
+		}
+	}
+	if slices.Contains(restoredIDs, ids[0]) {
+		t.Errorf("restored version kept its old ID %s: %v", ids[0], restoredIDs)
+	}
+
+	if err := vault.RestoreVersion("notes.txt", ids[0], key); err == nil {
+		t.Error("restored a version that no longer exists")
+	}
+}
+
+func TestVersionIDsAreNotReusedAfterPruning(t *testing.T) {
+	vault, key, _ := newTestVault(t)
+	if err := vault.SetSettings(Settings{VersionsToKeep: 1}, key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vault.AddFile("notes.txt", []byte("A"), key); err != nil {
+		t.Fatal(err)
+	}
+	var all []string
+	for _, body := range []string{"B", "C", "D"} {
+		if err := vault.UpdateFile("notes.txt", key, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+		ids, _ := versionBodies(t, vault, "notes.txt", key)
+		if len(ids) != 2 {
+			t.Fatalf("%d versions kept, want 2", len(ids))
+		}
+		all = append(all, ids[len(ids)-1])
+	}
+	checkUnique(t, all)
+}
+
+func TestNumberVersionsOfOlderVaults(t *testing.T) {
+	vault, key, vaultPath := newTestVault(t)
+	if err := vault.AddFile("notes.txt", []byte("A"), key); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"B", "A"} {
+		if err := vault.UpdateFile("notes.txt", key, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Vaults saved before versions were numbered have no numbers at all.
+	file := &vault.Files[0]
+	file.Seq = 0
+	for n := range file.Versions {
+		file.Versions[n].Seq = 0
+	}
+	if err := vault.Save(vaultPath); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+
+	readOnly, key, err := OpenVaultReadOnly(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnlyIDs, _ := versionBodies(t, readOnly, "notes.txt", key)
+
+	reopened, key, err := OpenVault(vaultPath, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	ids, bodies := versionBodies(t, reopened, "notes.txt", key)
+	checkUnique(t, ids)
+	if got := strings.Join(bodies, ""); got != "ABA" {
+		t.Fatalf("versions hold %v, want A, B, A", bodies)
+	}
+	if !slices.Equal(ids, readOnlyIDs) {
+		t.Errorf("read-only open numbered versions %v, writer %v", readOnlyIDs, ids)
+	}
+}
@@ -0,0 +1,433 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultOpenTimeout is how long a file opened temporarily is left alone
+// before it is closed, when Settings.OpenTimeout is zero.
+const DefaultOpenTimeout = 30 * time.Minute
+
+// workspaceLockName is the lock file a workspace holds for as long as it
+// is in use. A workspace whose lock can be taken was left behind by a
+// process that crashed. WorkspaceRoot has a lock file of the same name,
+// held while a workspace is created and while stale ones are wiped, so
+// that a new workspace is not wiped before it is locked.
+const workspaceLockName = ".lock"
+
+// A Workspace holds entries opened temporarily. Each is decrypted into a
+// private directory, put back into the vault when its file changes, and
+// overwritten and deleted when it is closed. Workspaces live under
+// WorkspaceRoot, which is normally on a tmpfs.
+type Workspace struct {
+	vault *Vault
+	key   []byte
+	dir   string
+	lock  *fileLock
+
+	mu     sync.Mutex
+	files  map[string]*openFile
+	closed bool
+}
+
+// openFile is an entry open in a workspace, with what its file looked like
+// when it was last synced.
+type openFile struct {
+	name    string
+	path    string
+	modTime time.Time
+	size    int64
+	active  time.Time
+}
+
+// OpenFile is an entry open in a workspace. Active is when it was opened
+// or last changed.
+type OpenFile struct {
+	Name   string
+	Path   string
+	Active time.Time
+}
+
+// WorkspaceRoot returns the private directory workspaces are created in,
+// creating it if needed: $XDG_RUNTIME_DIR/secure-file-vault, or a
+// directory in the system's temporary directory if that is not set.
+func WorkspaceRoot() (string, error) {
+	root := filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "secure-file-vault")
+	if os.Getenv("XDG_RUNTIME_DIR") == "" {
+		root = filepath.Join(os.TempDir(), fmt.Sprintf("secure-file-vault-%d", os.Getuid()))
+	}
+
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return "", fmt.Errorf("failed to create workspace directory: %v", err)
+	}
+	info, err := os.Lstat(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to create workspace directory: %v", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", root)
+	}
+	// Only the owner can change the mode, so this also fails if the
+	// directory was created by somebody else.
+	if err := os.Chmod(root, 0700); err != nil {
+		return "", fmt.Errorf("failed to secure workspace directory: %v", err)
+	}
+	return root, nil
+}
+
+// NewWorkspace creates an empty workspace for the vault.
+func (vault *Vault) NewWorkspace(key []byte) (*Workspace, error) {
+	root, err := WorkspaceRoot()
+	if err != nil {
+		return nil, err
+	}
+	rootLock, err := lockWorkspaceRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	defer rootLock.release()
+
+	dir, err := os.MkdirTemp(root, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %v", err)
+	}
+	lock, err := lockWorkspaceFile(filepath.Join(dir, workspaceLockName))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to lock workspace: %v", err)
+	}
+
+	return &Workspace{
+		vault: vault,
+		key:   key,
+		dir:   dir,
+		lock:  lock,
+		files: make(map[string]*openFile),
+	}, nil
+}
+
+// lockWorkspaceRoot takes the lock of the workspace root, waiting a few
+// seconds for another process that is creating or wiping workspaces.
+func lockWorkspaceRoot(root string) (*fileLock, error) {
+	for tries := 1; ; tries++ {
+		lock, err := lockWorkspaceFile(filepath.Join(root, workspaceLockName))
+		if err == errLockHeld && tries < 500 {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock workspace directory: %v", err)
+		}
+		return lock, nil
+	}
+}
+
+// lockWorkspaceFile takes the lock at path and records this process as
+// its holder.
+func lockWorkspaceFile(path string) (*fileLock, error) {
+	lock, err := acquireLock(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(currentLockInfo())
+	if err == nil {
+		err = lock.write(data)
+	}
+	if err != nil {
+		lock.release()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// Open decrypts the entry named fileName into the workspace and returns
+// the path of its file. An entry that is already open is not decrypted
+// again. Files of a read-only vault are made read-only too.
+func (ws *Workspace) Open(fileName string) (string, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.closed {
+		return "", fmt.Errorf("workspace is closed")
+	}
+	for _, file := range ws.files {
+		if file.name == fileName {
+			file.active = time.Now()
+			return file.path, nil
+		}
+	}
+
+	dir, err := os.MkdirTemp(ws.dir, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to create directory: %v", err)
+	}
+	filePath := filepath.Join(dir, filepath.Base(filepath.FromSlash(fileName)))
+
+	out, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to create file: %v", err)
+	}
+	err = ws.vault.ExtractFileTo(fileName, ws.key, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && ws.vault.ReadOnly() {
+		err = os.Chmod(filePath, 0400)
+	}
+	if err != nil {
+		wipeDir(dir)
+		return "", err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		wipeDir(dir)
+		return "", err
+	}
+	ws.files[filePath] = &openFile{
+		name:    fileName,
+		path:    filePath,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		active:  time.Now(),
+	}
+	return filePath, nil
+}
+
+// Files lists the entries open in the workspace.
+func (ws *Workspace) Files() []OpenFile {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	files := make([]OpenFile, 0, len(ws.files))
+	for _, file := range ws.files {
+		files = append(files, OpenFile{Name: file.name, Path: file.path, Active: file.active})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files
+}
+
+// Sync puts every file that changed since it was opened or last synced
+// back into its entry, and returns the names of the entries updated. The
+// vault then needs saving.
+func (ws *Workspace) Sync() ([]string, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.closed {
+		return nil, nil
+	}
+	var updated []string
+	var errs []error
+	for _, file := range ws.files {
+		changed, err := ws.sync(file)
+		if err != nil {
+			errs = append(errs, err)
+		} else if changed {
+			updated = append(updated, file.name)
+		}
+	}
+	sort.Strings(updated)
+	return updated, errors.Join(errs...)
+}
+
+// sync updates file's entry if its file changed. A file that is missing,
+// as it briefly is while some editors save, is left for the next sync.
+// The caller must hold ws.mu.
+func (ws *Workspace) sync(file *openFile) (bool, error) {
+	if ws.vault.ReadOnly() {
+		return false, nil
+	}
+
+	in, err := os.Open(file.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(file.modTime) && info.Size() == file.size {
+		return false, nil
+	}
+
+	if err := ws.vault.UpdateFileFrom(file.name, ws.key, in); err != nil {
+		return false, fmt.Errorf("failed to update %s: %v", file.name, err)
+	}
+	file.modTime, file.size, file.active = info.ModTime(), info.Size(), time.Now()
+	return true, nil
+}
+
+// CloseFile syncs the file at filePath and then overwrites and deletes it.
+// It is deleted even if it could not be synced.
+func (ws *Workspace) CloseFile(filePath string) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	file, ok := ws.files[filePath]
+	if !ok {
+		return fmt.Errorf("file not open: %s", filePath)
+	}
+	return ws.closeFile(file)
+}
+
+// closeFile syncs and wipes file. The caller must hold ws.mu.
+func (ws *Workspace) closeFile(file *openFile) error {
+	_, err := ws.sync(file)
+	delete(ws.files, file.path)
+	if wipeErr := wipeDir(filepath.Dir(file.path)); err == nil {
+		err = wipeErr
+	}
+	return err
+}
+
+// Expire closes the files that have been neither opened nor changed, as
+// seen by Sync, for longer than the vault's OpenTimeout, and returns the
+// names of their entries. The vault needs saving if any were closed.
+func (ws *Workspace) Expire() ([]string, error) {
+	timeout := ws.vault.Settings().OpenTimeoutOrDefault()
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.closed {
+		return nil, nil
+	}
+	var expired []string
+	var errs []error
+	for _, file := range ws.files {
+		if time.Since(file.active) <= timeout {
+			continue
+		}
+		errs = append(errs, ws.closeFile(file))
+		expired = append(expired, file.name)
+	}
+	sort.Strings(expired)
+	return expired, errors.Join(errs...)
+}
+
+// Close syncs and wipes every file and removes the workspace. Files are
+// wiped even if they could not be synced.
+func (ws *Workspace) Close() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.closed {
+		return nil
+	}
+	ws.closed = true
+
+	var errs []error
+	for _, file := range ws.files {
+		errs = append(errs, ws.closeFile(file))
+	}
+
+	// Once unlocked, the workspace looks stale until it is gone.
+	rootLock, err := lockWorkspaceRoot(filepath.Dir(ws.dir))
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		defer rootLock.release()
+	}
+	ws.lock.release()
+	errs = append(errs, wipeDir(ws.dir))
+	return errors.Join(errs...)
+}
+
+// WipeStaleWorkspaces wipes the workspaces left behind by processes that
+// exited without closing them, such as after a crash.
+func WipeStaleWorkspaces() error {
+	root, err := WorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	rootLock, err := lockWorkspaceRoot(root)
+	if err != nil {
+		return err
+	}
+	defer rootLock.release()
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return fmt.Errorf("failed to read workspace directory: %v", err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		lock, err := acquireLock(filepath.Join(dir, workspaceLockName))
+		if err == errLockHeld {
+			continue
+		}
+		if err == nil {
+			lock.release()
+		}
+		errs = append(errs, wipeDir(dir))
+	}
+	return errors.Join(errs...)
+}
+
+// wipeDir overwrites every regular file in dir with zeros before removing
+// dir. Symbolic links are removed without being followed.
+func wipeDir(dir string) error {
+	var errs []error
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			errs = append(errs, wipeFile(path))
+		}
+		return nil
+	})
+	if err := os.RemoveAll(dir); err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove %s: %v", dir, err))
+	}
+	return errors.Join(errs...)
+}
+
+// wipeFile overwrites the file at path with zeros and syncs it to disk.
+func wipeFile(path string) error {
+	// The file may have been made read-only.
+	os.Chmod(path, 0600)
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to wipe %s: %v", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err == nil {
+		_, err = io.CopyN(file, zeroReader{}, info.Size())
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to wipe %s: %v", path, err)
+	}
+	return nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
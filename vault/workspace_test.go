@@ -0,0 +1,152 @@
+package vault
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkspace(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	vault, key, _ := newTestVault(t)
+	for _, name := range []string{"docs/a.txt", "b.txt"} {
+		if err := vault.AddFile(name, []byte(name), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ws, err := vault.NewWorkspace(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	filePath, err := ws.Open("docs/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := ws.Open("docs/a.txt"); err != nil || again != filePath {
+		t.Errorf("opening again gave %s, %v; want %s", again, err, filePath)
+	}
+	if got := readDiskFile(t, filePath); got != "docs/a.txt" {
+		t.Errorf("opened file holds %q", got)
+	}
+
+	if updated, err := ws.Sync(); err != nil || len(updated) != 0 {
+		t.Errorf("unchanged file synced: %v, %v", updated, err)
+	}
+	if err := os.WriteFile(filePath, []byte("changed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if updated, err := ws.Sync(); err != nil || len(updated) != 1 {
+		t.Errorf("changed file not synced: %v, %v", updated, err)
+	}
+	if data, err := readEntry(vault, "docs/a.txt", key); err != nil || data != "changed" {
+		t.Errorf("entry holds %q, %v after sync", data, err)
+	}
+
+	// A file changed just before it expires is put back first.
+	other, err := ws.Open("b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.SetSettings(Settings{OpenTimeout: time.Millisecond}, key); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := os.WriteFile(other, []byte("last change"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expired, err := ws.Expire()
+	if err != nil || len(expired) != 2 {
+		t.Errorf("expired %v, %v; want both files", expired, err)
+	}
+	for _, path := range []string{filePath, other} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was not wiped", path)
+		}
+	}
+	if data, err := readEntry(vault, "b.txt", key); err != nil || data != "last change" {
+		t.Errorf("entry holds %q, %v after expiring", data, err)
+	}
+}
+
+func TestWipeStaleWorkspaces(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	vault, key, _ := newTestVault(t)
+	if err := vault.AddFile("a.txt", []byte("a"), key); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := vault.NewWorkspace(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stalePath, err := stale.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The process holding it crashed.
+	stale.lock.release()
+
+	live, err := vault.NewWorkspace(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	livePath, err := live.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WipeStaleWorkspaces(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stalePath); !os.IsNotExist(err) {
+		t.Error("stale workspace was not wiped")
+	}
+	if _, err := os.Stat(livePath); err != nil {
+		t.Errorf("live workspace was wiped: %v", err)
+	}
+}
+
+func TestNewWorkspaceWhileWiping(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	vault, key, _ := newTestVault(t)
+	if err := vault.AddFile("a.txt", []byte("a"), key); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	var wiper sync.WaitGroup
+	wiper.Add(1)
+	go func() {
+		defer wiper.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := WipeStaleWorkspaces(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		ws, err := vault.NewWorkspace(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ws.Open("a.txt"); err != nil {
+			t.Errorf("new workspace was wiped: %v", err)
+		}
+		if err := ws.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+	close(stop)
+	wiper.Wait()
+}